@@ -0,0 +1,140 @@
+package core
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	integerRegexp  = "-?\\d+"
+	floatRegexp    = "-?\\d*\\.?\\d+"
+	durationRegexp = "-?(?:(?:\\d+\\.?\\d*|\\.\\d+)(?:ns|us|µs|ms|s|m|h))+"
+	// timestampRegexp matches RFC 3339 timestamps such as 2006-01-02T15:04:05Z
+	timestampRegexp = "\\d{4}-\\d{2}-\\d{2}T\\d{2}:\\d{2}:\\d{2}(?:\\.\\d+)?(?:Z|[+-]\\d{2}:\\d{2})"
+)
+
+// quotedStringRegexps match text in double or single quotes, in which the
+// quote can be escaped with a backslash
+var quotedStringRegexps = []string{
+	"\"(?:[^\"\\\\]|\\\\.)*\"",
+	"'(?:[^'\\\\]|\\\\.)*'",
+}
+
+// builtinTransforms returns the transforms every Cucumber starts with. The
+// transform named "" is the anonymous {} parameter, it also captures the
+// parameters whose type cannot be inferred.
+//
+// Like in the Cucumber Expressions standard {string} only matches text in
+// quotes, which it strips. It used to be registered by hand as ".+" matching
+// any text: such step definitions should use {} instead, or register their
+// own "string" transform with AddTransform, which replaces the built-in one.
+func builtinTransforms() map[string]*Transform {
+	return map[string]*Transform{
+		"": &Transform{
+			CaptureRegexp: ".*",
+			Transformer: func(value string) (interface{}, error) {
+				return value, nil
+			},
+		},
+		"int": &Transform{
+			CaptureRegexp: integerRegexp,
+			Transformer: func(value string) (interface{}, error) {
+				result, err := strconv.ParseInt(value, 10, 0)
+				return int(result), err
+			},
+			Type:                 reflect.TypeOf(int(0)),
+			UseForSnippets:       true,
+			PreferForRegexpMatch: true,
+		},
+		"byte": &Transform{
+			CaptureRegexp: integerRegexp,
+			Transformer: func(value string) (interface{}, error) {
+				result, err := strconv.ParseUint(value, 10, 8)
+				return byte(result), err
+			},
+			Type: reflect.TypeOf(byte(0)),
+		},
+		"short": &Transform{
+			CaptureRegexp: integerRegexp,
+			Transformer: func(value string) (interface{}, error) {
+				result, err := strconv.ParseInt(value, 10, 16)
+				return int16(result), err
+			},
+			Type: reflect.TypeOf(int16(0)),
+		},
+		"long": &Transform{
+			CaptureRegexp: integerRegexp,
+			Transformer: func(value string) (interface{}, error) {
+				return strconv.ParseInt(value, 10, 64)
+			},
+			Type: reflect.TypeOf(int64(0)),
+		},
+		"float": &Transform{
+			CaptureRegexp: floatRegexp,
+			Transformer: func(value string) (interface{}, error) {
+				return strconv.ParseFloat(value, 64)
+			},
+			Type:           reflect.TypeOf(float64(0)),
+			UseForSnippets: true,
+		},
+		"bigdecimal": &Transform{
+			CaptureRegexp: floatRegexp,
+			// a rational holds decimals such as 0.1 exactly, unlike a float
+			Transformer: func(value string) (interface{}, error) {
+				result, ok := new(big.Rat).SetString(value)
+				if !ok {
+					return nil, fmt.Errorf("%q is not a decimal number", value)
+				}
+				return result, nil
+			},
+			Type: reflect.TypeOf((*big.Rat)(nil)),
+		},
+		"bool": &Transform{
+			CaptureRegexp: "true|false",
+			Transformer: func(value string) (interface{}, error) {
+				return strconv.ParseBool(value)
+			},
+			Type: reflect.TypeOf(false),
+		},
+		"word": &Transform{
+			CaptureRegexp: "[^\\s]+",
+			Transformer: func(value string) (interface{}, error) {
+				return value, nil
+			},
+			Type: reflect.TypeOf(""),
+		},
+		"string": &Transform{
+			CaptureRegexps: quotedStringRegexps,
+			Transformer: func(value string) (interface{}, error) {
+				return unquote(value), nil
+			},
+			Type:           reflect.TypeOf(""),
+			UseForSnippets: true,
+		},
+		"duration": &Transform{
+			CaptureRegexp: durationRegexp,
+			Transformer: func(value string) (interface{}, error) {
+				return time.ParseDuration(value)
+			},
+			Type: reflect.TypeOf(time.Duration(0)),
+		},
+		"timestamp": &Transform{
+			CaptureRegexp: timestampRegexp,
+			Transformer: func(value string) (interface{}, error) {
+				return time.Parse(time.RFC3339, value)
+			},
+			Type: reflect.TypeOf(time.Time{}),
+		},
+	}
+}
+
+// unquote strips the quotes of a quoted string and resolves the backslash
+// escapes in it
+func unquote(value string) string {
+	quote := value[:1]
+	return strings.NewReplacer("\\"+quote, quote, "\\\\", "\\").Replace(value[1 : len(value)-1])
+}
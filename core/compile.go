@@ -11,6 +11,10 @@ import (
 var outlinePattern = regexp.MustCompile("(<[^>]+>)")
 
 type Pickle struct {
+	// Name is the name of the scenario and Line the line of the scenario, or of
+	// the examples row for a scenario outline
+	Name     string
+	Line     int
 	Tags     []string
 	Steps    []*PickleStep
 	Feature  *gherkin.Feature
@@ -38,6 +42,8 @@ func (c *Cucumber) compileFeatureFile(doc *featureFile) ([]*Pickle, error) {
 			background = node
 		case *gherkin.Scenario:
 			pickle := &Pickle{
+				Name:     node.Name,
+				Line:     node.Location.Line,
 				Tags:     []string{},
 				Steps:    []*PickleStep{},
 				Feature:  doc.document.Feature,
@@ -70,6 +76,8 @@ func (c *Cucumber) compileFeatureFile(doc *featureFile) ([]*Pickle, error) {
 				}
 				for _, row := range example.TableBody {
 					pickle := &Pickle{
+						Name:     node.Name,
+						Line:     row.Location.Line,
 						Tags:     []string{},
 						Steps:    []*PickleStep{},
 						Feature:  doc.document.Feature,
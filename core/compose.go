@@ -1,107 +1,88 @@
 package core
 
 import (
-	"fmt"
-	"strings"
+	"time"
 
 	"github.com/cucumber/gherkin-go"
-
-	"github.com/playlyfe/cucumber/utils"
 )
 
-func (c *Cucumber) composeScenario(pickle *Pickle, requiredTags []string) (*TestCase, error) {
+func (c *Cucumber) composeScenario(pickle *Pickle, tagExpression TagExpression, stepTimeout time.Duration) (*TestCase, error) {
 	// filter tags
-	if c.matchTags(requiredTags, pickle.Tags) {
+	if tagExpression.Evaluate(pickle.Tags) {
+		stepTimeout, err := scenarioTimeout(pickle, stepTimeout)
+		if err != nil {
+			return nil, err
+		}
 		testCase := &TestCase{
-			BeforeHooks: []BeforeHook{},
-			AfterHooks:  []AfterHook{},
-			Pickle:      pickle,
-			Steps:       []*TestStep{},
+			stepTimeout:     stepTimeout,
+			World:           c.World,
+			WorldFactory:    c.WorldFactory,
+			BeforeHooks:     []*Hook{},
+			AfterHooks:      []*Hook{},
+			AroundHooks:     []*Hook{},
+			Pickle:          pickle,
+			Steps:           []*TestStep{},
+			transformLookup: c.transformLookup,
 		}
 
 		for _, pickleStep := range pickle.Steps {
 			testStep := &TestStep{
 				PickleStep: pickleStep,
-				Text:       c.compileStepDefinitionText(pickleStep.Text),
 			}
+			testStep.Text, testStep.snippetParameters = c.compileStepDefinitionText(pickleStep.Text)
 
-			// match step definitions
+			// match step definitions, a step matched by more than one step
+			// definition is ambiguous
+			matches := []*StepDefinition{}
 			for _, item := range c.stepDefinitions {
-				match, arguments, err := item.Expression.match(pickleStep.Text)
-				if err != nil {
-					return nil, err
-				}
-				if docString, ok := pickleStep.Step.Argument.(*gherkin.DocString); ok {
-					arguments = append(arguments, &argument{
-						transformedValue: docString.Content,
-					})
-				}
-
-				testStep.Arguments = append([]*argument{
-					&argument{
-						transformedValue: c.World,
-					},
-				}, arguments...)
+				match, arguments := item.Expression.match(pickleStep.Text)
 				if match {
-					testStep.StepDefinition = item
-					break
+					if len(matches) == 0 {
+						testStep.StepDefinition = item
+						testStep.Arguments = arguments
+					}
+					matches = append(matches, item)
 				}
 			}
+			if len(matches) > 1 {
+				testStep.StepDefinition = nil
+				testStep.Arguments = nil
+				testStep.AmbiguousStepDefinitions = matches
+			}
+			switch node := pickleStep.Step.Argument.(type) {
+			case *gherkin.DocString:
+				testStep.Arguments = append(testStep.Arguments, &argument{
+					transformedValue: newDocStringFromGherkin(node),
+				})
+			case *gherkin.DataTable:
+				testStep.Arguments = append(testStep.Arguments, &argument{
+					transformedValue: newDataTableFromGherkin(node),
+				})
+			}
 
 			testCase.Steps = append(testCase.Steps, testStep)
 		}
 
 		// filter and add hooks
 		for _, hook := range c.beforeHooks {
-			if c.matchTags(hook.tags, pickle.Tags) {
-				testCase.BeforeHooks = append(testCase.BeforeHooks, hook.fn.(BeforeHook))
+			if hook.tagExpression.Evaluate(pickle.Tags) {
+				testCase.BeforeHooks = append(testCase.BeforeHooks, hook)
 			}
 		}
 
 		for _, hook := range c.afterHooks {
-			if c.matchTags(hook.tags, pickle.Tags) {
-				testCase.AfterHooks = append(testCase.AfterHooks, hook.fn.(AfterHook))
+			if hook.tagExpression.Evaluate(pickle.Tags) {
+				testCase.AfterHooks = append(testCase.AfterHooks, hook)
 			}
 		}
 
-		return testCase, nil
-	}
-	return nil, nil
-}
-
-func (c *Cucumber) compileStepDefinitionText(expression string) string {
-	sb := ""
-	matches := paramPattern.FindAllStringSubmatch(expression, -1)
-	matchIndexes := paramPattern.FindAllStringSubmatchIndex(expression, -1)
-	lastIndex := 0
-	for index := 0; index < len(matches); index++ {
-		matchIndex := matchIndexes[index]
-		text := expression[lastIndex:matchIndex[0]]
-		captureRegexp := fmt.Sprintf("\"{arg%d}\"", index)
-		lastIndex = matchIndex[1]
-		sb += text
-		sb += captureRegexp
-	}
-	sb += expression[lastIndex:]
-	return strings.TrimSpace(sb)
-}
-
-func (c *Cucumber) matchTags(requiredTags []string, tags []string) bool {
-	match := true
-	for _, andTags := range requiredTags {
-		orMatch := false
-		orTags := strings.Split(andTags, ",")
-		for _, orTag := range orTags {
-			if utils.SetExists(tags, orTag) {
-				orMatch = true
-				break
+		for _, hook := range c.aroundHooks {
+			if hook.tagExpression.Evaluate(pickle.Tags) {
+				testCase.AroundHooks = append(testCase.AroundHooks, hook)
 			}
 		}
-		if !orMatch {
-			match = false
-			break
-		}
 
+		return testCase, nil
 	}
-	return match
+	return nil, nil
 }
@@ -0,0 +1,120 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+)
+
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// Scenario describes the test case a step definition or hook runs for. It is
+// carried by the context passed to them.
+type Scenario struct {
+	Name     string
+	Tags     []string
+	FilePath string
+	Line     int
+}
+
+type scenarioKey struct{}
+
+// ScenarioFromContext returns the scenario running with the given context or
+// nil outside of a test case
+func ScenarioFromContext(ctx context.Context) *Scenario {
+	scenario, _ := ctx.Value(scenarioKey{}).(*Scenario)
+	return scenario
+}
+
+func withScenario(ctx context.Context, pickle *Pickle) context.Context {
+	return context.WithValue(ctx, scenarioKey{}, &Scenario{
+		Name:     pickle.Name,
+		Tags:     pickle.Tags,
+		FilePath: pickle.FilePath,
+		Line:     pickle.Line,
+	})
+}
+
+// detachedContext keeps the values of its parent but is never cancelled, so
+// that After hooks can still clean up once a run is cancelled
+type detachedContext struct {
+	parent context.Context
+}
+
+func (c detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (c detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (c detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// takesContext reports whether a step definition or hook function takes a
+// context as its first parameter
+func takesContext(fnType reflect.Type) bool {
+	return fnType.NumIn() > 0 && fnType.In(0) == contextType
+}
+
+// argumentIndex returns the index of the first parameter of a step
+// definition function after the context and the world
+func argumentIndex(fnType reflect.Type) int {
+	if takesContext(fnType) {
+		return 2
+	}
+	return 1
+}
+
+// gracePeriod is the time a step or hook is given to return once its context
+// is done, before the steps and hooks after it run regardless
+var gracePeriod = 5 * time.Second
+
+// errGoexit is the error of a step or hook that called runtime.Goexit, as
+// testing.T.FailNow does, instead of returning
+var errGoexit = errors.New("exited without returning, runtime.Goexit was called")
+
+// runWithContext calls fn and returns what it returns. When ctx can be done fn
+// runs in its own goroutine and, once ctx is done, is given the grace period
+// to return before the error of ctx is returned. A function that ignores its
+// context cannot be stopped, it is then left running in the background.
+func runWithContext(ctx context.Context, fn func() (context.Context, error)) (context.Context, error) {
+	if err := ctx.Err(); err != nil {
+		return ctx, err
+	}
+	if ctx.Done() == nil {
+		return fn()
+	}
+	type result struct {
+		ctx context.Context
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		item := result{
+			ctx: ctx,
+			err: errGoexit,
+		}
+		defer func() {
+			done <- item
+		}()
+		item.ctx, item.err = fn()
+	}()
+	select {
+	case item := <-done:
+		return item.ctx, item.err
+	case <-ctx.Done():
+	}
+	select {
+	case <-done:
+	case <-time.After(gracePeriod):
+	}
+	return ctx, ctx.Err()
+}
@@ -0,0 +1,45 @@
+package core
+
+import (
+	"context"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunWithContext(t *testing.T) {
+	defer func(previous time.Duration) {
+		gracePeriod = previous
+	}(gracePeriod)
+	gracePeriod = time.Second
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err := runWithContext(ctx, func() (context.Context, error) {
+		runtime.Goexit()
+		return nil, nil
+	})
+	if err != errGoexit {
+		t.Errorf("expected the Goexit error but got %v", err)
+	}
+
+	// a function ignoring its context is given the grace period to return
+	var returned int32
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	_, err = runWithContext(ctx, func() (context.Context, error) {
+		time.Sleep(100 * time.Millisecond)
+		atomic.StoreInt32(&returned, 1)
+		return nil, nil
+	})
+	if err != context.Canceled {
+		t.Errorf("expected the context to be cancelled but got %v", err)
+	}
+	if atomic.LoadInt32(&returned) != 1 {
+		t.Errorf("expected the function to have returned within the grace period")
+	}
+
+}
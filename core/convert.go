@@ -0,0 +1,285 @@
+package core
+
+import (
+	"encoding"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+)
+
+// transformNameForType returns the name of the transform producing values of
+// the given type. A transform declaring the type wins over the transforms
+// picked by the kind of the type, strings and types parsing text themselves
+// are captured by the anonymous transform.
+func transformNameForType(valueType reflect.Type, transformLookup map[string]*Transform) string {
+	names := []string{}
+	for name, transform := range transformLookup {
+		if transform.Type != nil && transform.Type == valueType && valueType.Kind() != reflect.String {
+			names = append(names, name)
+		}
+	}
+	if len(names) > 0 {
+		sort.Strings(names)
+		return names[0]
+	}
+	if parsesText(valueType) {
+		return ""
+	}
+	switch valueType.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "int"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.Bool:
+		return "bool"
+	}
+	return ""
+}
+
+// FromStep is implemented by step definition parameter types that parse the
+// text of a step argument themselves, like encoding.TextUnmarshaler. It is
+// implemented with a pointer receiver.
+type FromStep interface {
+	FromStep(text string) error
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+var fromStepType = reflect.TypeOf((*FromStep)(nil)).Elem()
+
+// parsesText reports whether values of a type parse text themselves through
+// FromStep or encoding.TextUnmarshaler
+func parsesText(target reflect.Type) bool {
+	if target.Kind() != reflect.Ptr {
+		target = reflect.PtrTo(target)
+	}
+	return target.Implements(fromStepType) || target.Implements(textUnmarshalerType)
+}
+
+// parseText creates a value of a type implementing FromStep or
+// encoding.TextUnmarshaler from text
+func parseText(text string, target reflect.Type) (reflect.Value, error) {
+	pointer := reflect.New(target)
+	if target.Kind() == reflect.Ptr {
+		pointer = reflect.New(target.Elem())
+	}
+	var err error
+	if parser, ok := pointer.Interface().(FromStep); ok {
+		err = parser.FromStep(text)
+	} else {
+		err = pointer.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text))
+	}
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf("cannot parse %q as %s: %s", text, target, err)
+	}
+	if target.Kind() == reflect.Ptr {
+		return pointer, nil
+	}
+	return pointer.Elem(), nil
+}
+
+// convertValue converts a transformed value to the type a step definition
+// declares for it
+func convertValue(value interface{}, target reflect.Type) (reflect.Value, error) {
+	if value == nil {
+		return reflect.New(target).Elem(), nil
+	}
+	result := reflect.ValueOf(value)
+	if result.Type().AssignableTo(target) {
+		return result, nil
+	}
+	if text, ok := value.(string); ok && parsesText(target) {
+		return parseText(text, target)
+	}
+	if isNumber(result.Type()) && isNumber(target) {
+		return convertNumber(result, target)
+	}
+	if canConvert(result.Type(), target) {
+		return result.Convert(target), nil
+	}
+	return reflect.Value{}, fmt.Errorf("cannot convert %v of type %s to %s", value, result.Type(), target)
+}
+
+// canConvert reports whether values of one type can be converted to another
+// type for a step definition parameter
+func canConvert(from reflect.Type, to reflect.Type) bool {
+	if from.Kind() == reflect.String && parsesText(to) {
+		return true
+	}
+	// converting a number to a string would turn it into a rune
+	if to.Kind() == reflect.String && from.Kind() != reflect.String {
+		return false
+	}
+	return from.ConvertibleTo(to)
+}
+
+func isNumber(valueType reflect.Type) bool {
+	switch valueType.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// convertNumber widens or narrows a number to another numeric type. Numbers
+// that do not fit the type and fractions converted to integers are errors.
+func convertNumber(value reflect.Value, target reflect.Type) (reflect.Value, error) {
+	result := reflect.New(target).Elem()
+	overflow := fmt.Errorf("%v overflows %s", value.Interface(), target)
+	switch target.Kind() {
+	case reflect.Float32, reflect.Float64:
+		number := toFloat(value)
+		if result.OverflowFloat(number) {
+			return reflect.Value{}, overflow
+		}
+		result.SetFloat(number)
+		return result, nil
+	}
+	if value.Kind() == reflect.Float32 || value.Kind() == reflect.Float64 {
+		number := value.Float()
+		if number != math.Trunc(number) {
+			return reflect.Value{}, fmt.Errorf("%v is not a whole number and cannot be converted to %s", number, target)
+		}
+		if number < math.MinInt64 || number >= math.MaxInt64 {
+			return reflect.Value{}, overflow
+		}
+		value = reflect.ValueOf(int64(number))
+	}
+	switch target.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if isSigned(value) && value.Int() < 0 {
+			return reflect.Value{}, fmt.Errorf("%v is negative and cannot be converted to %s", value.Interface(), target)
+		}
+		number := toUint(value)
+		if result.OverflowUint(number) {
+			return reflect.Value{}, overflow
+		}
+		result.SetUint(number)
+	default:
+		if !isSigned(value) && value.Uint() > math.MaxInt64 {
+			return reflect.Value{}, overflow
+		}
+		number := toInt(value)
+		if result.OverflowInt(number) {
+			return reflect.Value{}, overflow
+		}
+		result.SetInt(number)
+	}
+	return result, nil
+}
+
+func isSigned(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+func toFloat(value reflect.Value) float64 {
+	switch value.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return value.Float()
+	}
+	if isSigned(value) {
+		return float64(value.Int())
+	}
+	return float64(value.Uint())
+}
+
+func toInt(value reflect.Value) int64 {
+	if isSigned(value) {
+		return value.Int()
+	}
+	return int64(value.Uint())
+}
+
+func toUint(value reflect.Value) uint64 {
+	if isSigned(value) {
+		return uint64(value.Int())
+	}
+	return value.Uint()
+}
+
+// transformText converts a piece of step text such as a table cell to the
+// given type with the transform registered for it
+func transformText(text string, target reflect.Type, transformLookup map[string]*Transform) (reflect.Value, error) {
+	if target.Kind() == reflect.Ptr {
+		value, err := transformText(text, target.Elem(), transformLookup)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		pointer := reflect.New(target.Elem())
+		pointer.Elem().Set(value)
+		return pointer, nil
+	}
+	if target.Kind() == reflect.String && !parsesText(target) {
+		return reflect.ValueOf(text).Convert(target), nil
+	}
+	name := transformNameForType(target, transformLookup)
+	transform, ok := transformLookup[name]
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("no transform is registered for %s", target)
+	}
+	match := regexp.MustCompile("^(?:" + transform.captureRegexp() + ")$").FindStringSubmatch(text)
+	if match == nil {
+		return reflect.Value{}, fmt.Errorf("%q does not match the %s transform", text, name)
+	}
+	value, err := transform.transform(text, match[1:])
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return convertValue(value, target)
+}
+
+// inferTargetTypes picks the transform of every parameter of a step
+// definition expression from the types of the parameters of the step
+// definition function. The first parameter receives the world and the last
+// one may receive a doc string or table.
+func inferTargetTypes(parameters []*expressionNode, fn interface{}, transformLookup map[string]*Transform) ([]string, error) {
+	targetTypes := []string{}
+	fnType := reflect.TypeOf(fn)
+	if fnType == nil || fnType.Kind() != reflect.Func || fnType.NumIn() == 0 {
+		return targetTypes, nil
+	}
+	parameterCount := fnType.NumIn() - argumentIndex(fnType)
+	if parameterCount != len(parameters) && parameterCount != len(parameters)+1 {
+		return targetTypes, fmt.Errorf("has %d parameters but its function takes %d arguments after the world", len(parameters), parameterCount)
+	}
+	for index, parameter := range parameters {
+		parameterType := fnType.In(argumentIndex(fnType) + index)
+		typeName := parameter.typeName
+		if _, ok := transformLookup[parameter.text]; typeName == "" && ok {
+			// {name} refers to the type of that name when one is registered
+			typeName = parameter.text
+		}
+		if typeName != "" {
+			transform, ok := transformLookup[typeName]
+			if !ok {
+				return targetTypes, fmt.Errorf("has a %s parameter but no transform is registered for the type %s", parameter.source(), typeName)
+			}
+			if transform.Type != nil && !canConvert(transform.Type, parameterType) {
+				return targetTypes, fmt.Errorf("has a %s parameter of type %s but its function takes %s", parameter.source(), transform.Type, parameterType)
+			}
+			targetTypes = append(targetTypes, typeName)
+			continue
+		}
+		if parameterType.Kind() == reflect.Interface {
+			targetTypes = append(targetTypes, "")
+			continue
+		}
+		name := transformNameForType(parameterType, transformLookup)
+		if _, ok := transformLookup[name]; !ok && (parameterType.Kind() == reflect.String || parsesText(parameterType)) {
+			// text is captured as it is without the anonymous transform
+			name = ""
+		} else if !ok {
+			return targetTypes, fmt.Errorf("has a %s parameter but no transform is registered for its type %s", parameter.source(), parameterType)
+		}
+		targetTypes = append(targetTypes, name)
+	}
+	return targetTypes, nil
+}
@@ -0,0 +1,127 @@
+package core
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testColor struct {
+	name string
+}
+
+func (c *testColor) FromStep(text string) error {
+	if text != "red" && text != "blue" {
+		return fmt.Errorf("unknown color")
+	}
+	c.name = text
+	return nil
+}
+
+func TestConvertValue(t *testing.T) {
+	cases := []struct {
+		value    interface{}
+		target   interface{}
+		expected interface{}
+		err      string
+	}{
+		{42, int64(0), int64(42), ""},
+		{int64(42), int8(0), int8(42), ""},
+		{300, int8(0), nil, "overflows"},
+		{-1, uint(0), nil, "negative"},
+		{uint64(1 << 63), int64(0), nil, "overflows"},
+		{3, float32(0), float32(3), ""},
+		{2.0, int(0), 2, ""},
+		{2.5, int(0), nil, "whole number"},
+		{1e40, float32(0), nil, "overflows"},
+		{"red", testColor{}, testColor{"red"}, ""},
+		{"blue", &testColor{}, &testColor{"blue"}, ""},
+		{"green", testColor{}, nil, "unknown color"},
+		{"10.0.0.1", net.IP{}, net.ParseIP("10.0.0.1"), ""},
+		{42, "", nil, "cannot convert"},
+	}
+	for _, item := range cases {
+		target := reflect.TypeOf(item.target)
+		result, err := convertValue(item.value, target)
+		if item.err != "" {
+			if err == nil || !strings.Contains(err.Error(), item.err) {
+				t.Errorf("%v to %s: expected an error containing %q but got %v", item.value, target, item.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v to %s: unexpected error: %s", item.value, target, err)
+			continue
+		}
+		if !reflect.DeepEqual(result.Interface(), item.expected) {
+			t.Errorf("%v to %s: expected %v but got %v", item.value, target, item.expected, result.Interface())
+		}
+	}
+}
+
+func TestBigDecimalTransform(t *testing.T) {
+	result, err := builtinTransforms()["bigdecimal"].transform("0.1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.(*big.Rat).Cmp(big.NewRat(1, 10)) != 0 {
+		t.Errorf("expected exactly 1/10 but got %s", result)
+	}
+}
+
+func TestInferTargetTypes(t *testing.T) {
+	cases := []struct {
+		expression string
+		fn         interface{}
+		text       string
+		expected   interface{}
+		err        string
+	}{
+		{"it waits {}", func(world interface{}, value time.Duration) error { return nil }, "it waits 1m30s", 90 * time.Second, ""},
+		{"it counts {}", func(world interface{}, value int) error { return nil }, "it counts 42", 42, ""},
+		{"it says {}", func(world interface{}, value string) error { return nil }, "it says hi there", "hi there", ""},
+		{"it counts {int}", func(world interface{}, value int64) error { return nil }, "it counts 42", int64(42), ""},
+		{"it counts {int}", func(world interface{}, value uint8) error { return nil }, "it counts 255", uint8(255), ""},
+		{"it counts {int}", func(world interface{}, value uint8) error { return nil }, "it counts 300", nil, "overflows"},
+		{"it counts {int}", func(world interface{}, value uint8) error { return nil }, "it counts -1", nil, "negative"},
+		{"it counts {int}", func(world interface{}, value bool) error { return nil }, "", nil, "its function takes bool"},
+		{"it counts {}", func(world interface{}, value chan int) error { return nil }, "it counts 5", nil, "cannot convert"},
+		{"it counts {} {}", func(world interface{}, value int) error { return nil }, "", nil, "has 2 parameters"},
+		{"it is {n:nothing}", func(world interface{}, value int) error { return nil }, "", nil, "no transform is registered for the type nothing"},
+	}
+	lookup := builtinTransforms()
+	for _, item := range cases {
+		tree, err := parseCucumberExpression(item.expression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		targetTypes, err := inferTargetTypes(tree.parameters(), item.fn, lookup)
+		var result reflect.Value
+		if err == nil {
+			expression := newCucumberExpression(tree, targetTypes, lookup)
+			match, arguments := expression.match(item.text)
+			if !match {
+				t.Errorf("%q: expected %q to match", item.expression, item.text)
+				continue
+			}
+			result, err = convertValue(arguments[0].transformedValue, reflect.TypeOf(item.fn).In(1))
+		}
+		if item.err != "" {
+			if err == nil || !strings.Contains(err.Error(), item.err) {
+				t.Errorf("%q with %T: expected an error containing %q but got %v", item.expression, item.fn, item.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q with %T: unexpected error: %s", item.expression, item.fn, err)
+			continue
+		}
+		if !reflect.DeepEqual(result.Interface(), item.expected) {
+			t.Errorf("%q with %q: expected %v but got %v", item.expression, item.text, item.expected, result.Interface())
+		}
+	}
+}
@@ -1,10 +1,17 @@
 package core
 
 import (
+	"context"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/cucumber/gherkin-go"
 )
@@ -12,28 +19,69 @@ import (
 // Transform represents a cucumber transform expression
 type Transform struct {
 	CaptureRegexp string
-	Transformer   func(value string) (interface{}, error)
+	// CaptureRegexps are further regexps matching the same type, such as the
+	// other spellings of a value
+	CaptureRegexps []string
+	Transformer    func(value string) (interface{}, error)
+	// GroupTransformer is used instead of Transformer when set. It receives
+	// the text of every capture group of the matching regexp, or the whole
+	// match when the regexp has no capture groups.
+	GroupTransformer func(groups []string) (interface{}, error)
+	// Type is the Go type of the transformed values. Untyped placeholders
+	// whose step definition parameter has this type use the transform.
+	Type reflect.Type
+	// UseForSnippets makes the snippets of undefined steps turn text matching
+	// the transform into a parameter of its type
+	UseForSnippets bool
+	// PreferForRegexpMatch picks the transform over the others with the same
+	// regexp for the capture groups of regular expression step definitions
+	PreferForRegexpMatch bool
 }
 
 // Cucumber is a new cucumber
 type Cucumber struct {
-	World           interface{}
+	// World is shared by every test case unless a WorldFactory is set
+	World interface{}
+	// WorldFactory builds a fresh world for each test case. Worlds implementing
+	// io.Closer are closed once the test case has finished. The BeforeAll and
+	// AfterAll hooks are passed a nil world when it is set.
+	WorldFactory    func() interface{}
 	stepDefinitions []*StepDefinition
 	transformLookup map[string]*Transform
-	beforeAllHooks  []*hook
-	afterAllHooks   []*hook
-	beforeHooks     []*hook
-	afterHooks      []*hook
+	beforeAllHooks  []*Hook
+	afterAllHooks   []*Hook
+	beforeHooks     []*Hook
+	afterHooks      []*Hook
+	aroundHooks     []*Hook
 	eventBus        *EventBus
+	errors          []error
 }
 
 type BeforeHook func(world interface{}) error
 type AfterHook func(world interface{}) error
+
+// AroundHook wraps a test case, which runs when it calls next. Next returns
+// nil when the test case passed and otherwise the error it failed with or
+// ErrPending, ErrUndefined, ErrSkip or an *AmbiguousError for its status.
+// Returning the error of next does not fail the test case any further.
 type AroundHook func(world interface{}, next func() error) error
 
-type hook struct {
-	tags []string
-	fn   interface{}
+// ContextHook is a before or after hook taking the context of the test case.
+// The context it returns, if not nil, is passed on to the steps and hooks
+// after it.
+type ContextHook func(ctx context.Context, world interface{}) (context.Context, error)
+
+// ContextAroundHook is an around hook taking the context of the test case
+type ContextAroundHook func(ctx context.Context, world interface{}, next func() error) error
+
+// Hook is a registered hook. Tags restrict the test cases a Before, After or
+// Around hook applies to, Location is the file:line of the Go source the hook
+// was registered at.
+type Hook struct {
+	Tags          []string
+	Fn            interface{}
+	Location      string
+	tagExpression TagExpression
 }
 
 type CucumberError struct {
@@ -46,8 +94,32 @@ func (e *CucumberError) Error() string {
 }
 
 type StepDefinition struct {
+	// Expression is compiled when the run starts, against the transforms
+	// registered by then
 	Expression *CucumberExpression
 	Fn         interface{}
+	// Location is the file:line of the Go source the step was registered at
+	Location string
+	// Timeout limits the time a step may run, set with WithTimeout
+	Timeout time.Duration
+	text    string
+	// tree is the parsed cucumber expression, nil for a regular expression
+	tree *expressionTree
+}
+
+// AmbiguousError is the error of a step matched by more than one step
+// definition
+type AmbiguousError struct {
+	Text            string
+	StepDefinitions []*StepDefinition
+}
+
+func (e *AmbiguousError) Error() string {
+	message := fmt.Sprintf("Multiple step definitions match %q:", e.Text)
+	for _, stepDefinition := range e.StepDefinitions {
+		message += fmt.Sprintf("\n    %q  # %s", stepDefinition.Expression.Source, stepDefinition.Location)
+	}
+	return message
 }
 
 type file struct {
@@ -60,19 +132,43 @@ type featureFile struct {
 	document *gherkin.GherkinDocument
 }
 
-// NewCucumber creates a new Cucumber
+// NewCucumber creates a new Cucumber with the built-in parameter types int,
+// byte, short, long, float, bigdecimal, bool, word, string, duration and
+// timestamp. {string} matches quoted text only, {} matches any text.
 func NewCucumber() *Cucumber {
 	return &Cucumber{
 		stepDefinitions: []*StepDefinition{},
-		transformLookup: map[string]*Transform{},
+		transformLookup: builtinTransforms(),
 		eventBus:        NewEventBus(),
 	}
 }
 
+// AddTransform registers a parameter type, replacing the transform
+// registered with the same name
 func (c *Cucumber) AddTransform(typeName string, transform *Transform) {
+	if err := transform.validate(); err != nil {
+		c.registrationError(callerLocation(1), "transform %q %s", typeName, err)
+		return
+	}
 	c.transformLookup[typeName] = transform
 }
 
+// TransformNames returns the names of the registered transforms in
+// alphabetical order
+func (c *Cucumber) TransformNames() []string {
+	names := []string{}
+	for name := range c.transformLookup {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Transform returns the transform registered with the given name or nil
+func (c *Cucumber) Transform(typeName string) *Transform {
+	return c.transformLookup[typeName]
+}
+
 func (c *Cucumber) AddOuputFormatter(printHandler EventHandler) {
 	c.eventBus.RegisterHandler(TestRunStarting, printHandler)
 	c.eventBus.RegisterHandler(TestCaseStarting, printHandler)
@@ -82,82 +178,282 @@ func (c *Cucumber) AddOuputFormatter(printHandler EventHandler) {
 	c.eventBus.RegisterHandler(TestRunFinished, printHandler)
 }
 
+// BeforeAll registers a hook run once before the first test case. Its world is
+// the World of the Cucumber, nil when a WorldFactory is set.
 func (c *Cucumber) BeforeAll(fn BeforeHook) {
-	c.beforeAllHooks = append(c.beforeAllHooks, &hook{
-		fn: fn,
-	})
+	c.beforeAllHooks = append(c.beforeAllHooks, c.newHook("BeforeAll", fn, nil))
+}
+
+// BeforeAllContext registers a BeforeAll hook taking the context of the run.
+// The context it returns is the parent of the context of every test case.
+func (c *Cucumber) BeforeAllContext(fn ContextHook) {
+	c.beforeAllHooks = append(c.beforeAllHooks, c.newHook("BeforeAll", fn, nil))
 }
 
 func (c *Cucumber) AfterAll(fn AfterHook) {
-	c.afterAllHooks = append(c.afterAllHooks, &hook{
-		fn: fn,
-	})
+	c.afterAllHooks = append(c.afterAllHooks, c.newHook("AfterAll", fn, nil))
+}
+
+// AfterAllContext registers an AfterAll hook taking the context of the run
+func (c *Cucumber) AfterAllContext(fn ContextHook) {
+	c.afterAllHooks = append(c.afterAllHooks, c.newHook("AfterAll", fn, nil))
 }
 
 func (c *Cucumber) Before(fn BeforeHook, tags ...string) {
-	c.beforeHooks = append(c.beforeHooks, &hook{
-		tags: tags,
-		fn:   fn,
-	})
+	c.beforeHooks = append(c.beforeHooks, c.newHook("Before", fn, tags))
+}
+
+// BeforeContext registers a Before hook taking the context of the test case
+func (c *Cucumber) BeforeContext(fn ContextHook, tags ...string) {
+	c.beforeHooks = append(c.beforeHooks, c.newHook("Before", fn, tags))
 }
 
 func (c *Cucumber) After(fn AfterHook, tags ...string) {
-	c.afterHooks = append(c.afterHooks, &hook{
-		tags: tags,
-		fn:   fn,
-	})
-}
-
-func (c *Cucumber) Step() func(text string, fn interface{}) {
-	return func(text string, fn interface{}) {
-		targetTypes := []string{}
-		exp := newCucumberExpression(text, targetTypes, c.transformLookup)
-		c.stepDefinitions = append(c.stepDefinitions, &StepDefinition{
-			Fn:         fn,
-			Expression: exp,
-		})
+	c.afterHooks = append(c.afterHooks, c.newHook("After", fn, tags))
+}
+
+// AfterContext registers an After hook taking the context of the test case
+func (c *Cucumber) AfterContext(fn ContextHook, tags ...string) {
+	c.afterHooks = append(c.afterHooks, c.newHook("After", fn, tags))
+}
+
+func (c *Cucumber) Around(fn AroundHook, tags ...string) {
+	c.aroundHooks = append(c.aroundHooks, c.newHook("Around", fn, tags))
+}
+
+// AroundContext registers an Around hook taking the context of the test case
+func (c *Cucumber) AroundContext(fn ContextAroundHook, tags ...string) {
+	c.aroundHooks = append(c.aroundHooks, c.newHook("Around", fn, tags))
+}
+
+// newHook creates a hook registered by the caller of the hook registrar. The
+// tags of the hook are parsed as tag expressions that must all match.
+func (c *Cucumber) newHook(kind string, fn interface{}, tags []string) *Hook {
+	hook := &Hook{
+		Tags:     tags,
+		Fn:       fn,
+		Location: callerLocation(2),
+	}
+	if err := validateHookFn(fn); err != nil {
+		c.registrationError(hook.Location, "%s hook %s", kind, err)
+	}
+	tagExpression, err := parseTagExpressions(tags)
+	if err != nil {
+		c.registrationError(hook.Location, "%s hook has invalid tags: %s", kind, err)
+		tagExpression = &tagNot{
+			operand: &tagTrue{},
+		}
+	}
+	hook.tagExpression = tagExpression
+	return hook
+}
+
+// registrationError records an invalid step definition or hook. Execute
+// refuses to run while there are any.
+func (c *Cucumber) registrationError(location string, format string, args ...interface{}) {
+	c.errors = append(c.errors, newRegistrationError(location, format, args...))
+}
+
+func newRegistrationError(location string, format string, args ...interface{}) error {
+	return fmt.Errorf("%s: %s", location, fmt.Sprintf(format, args...))
+}
+
+// Step returns a function registering step definitions. A step definition is
+// a cucumber expression such as "I have {int} cucumber(s)", or a regular
+// expression such as "^I have (\d+) cucumbers?$" when it starts with '^' and
+// ends with '$'. Options such as WithTimeout configure the step definition.
+//
+// A step definition taking a context should return once the context is done.
+// One that ignores it cannot be stopped, after a grace period of 5 seconds it
+// is left running in the background while the After hooks run on its world.
+func (c *Cucumber) Step() func(text string, fn interface{}, options ...StepOption) {
+	return func(text string, fn interface{}, options ...StepOption) {
+		location := callerLocation(1)
+		if err := validateStepDefinitionFn(fn); err != nil {
+			c.registrationError(location, "step definition %q %s", text, err)
+			return
+		}
+		stepDefinition := &StepDefinition{
+			Fn:       fn,
+			Location: location,
+			text:     text,
+		}
+		if !isRegularExpression(text) {
+			tree, err := parseCucumberExpression(text)
+			if err != nil {
+				c.registrationError(location, "invalid step definition: %s", err)
+				return
+			}
+			stepDefinition.tree = tree
+		}
+		for _, option := range options {
+			option(stepDefinition)
+		}
+		c.stepDefinitions = append(c.stepDefinitions, stepDefinition)
+	}
+}
+
+// compileStepDefinitions compiles the expression of every step definition
+// against the transforms registered by now and returns the step definitions
+// that could not be compiled
+func (c *Cucumber) compileStepDefinitions() []error {
+	errors := []error{}
+	for _, stepDefinition := range c.stepDefinitions {
+		if stepDefinition.tree == nil {
+			exp, err := newRegularExpression(stepDefinition.text, stepDefinition.Fn, c.transformLookup)
+			if err != nil {
+				errors = append(errors, newRegistrationError(stepDefinition.Location, "step definition %q %s", stepDefinition.text, err))
+				continue
+			}
+			stepDefinition.Expression = exp
+			continue
+		}
+		// untyped parameters take the type of the matching function parameter
+		targetTypes, err := inferTargetTypes(stepDefinition.tree.parameters(), stepDefinition.Fn, c.transformLookup)
+		if err != nil {
+			errors = append(errors, newRegistrationError(stepDefinition.Location, "step definition %q %s", stepDefinition.text, err))
+			continue
+		}
+		stepDefinition.Expression = newCucumberExpression(stepDefinition.tree, targetTypes, c.transformLookup)
+	}
+	return errors
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// validateStepDefinitionFn checks the signature of a step definition function,
+// which must take the world first, optionally after a context, and return an
+// error or a context and an error
+func validateStepDefinitionFn(fn interface{}) error {
+	fnType := reflect.TypeOf(fn)
+	if fnType == nil {
+		return fmt.Errorf("has no function")
+	}
+	if fnType.Kind() != reflect.Func {
+		return fmt.Errorf("must be a function but is a %s", fnType)
+	}
+	if reflect.ValueOf(fn).IsNil() {
+		return fmt.Errorf("has no function")
+	}
+	if takesContext(fnType) && fnType.NumIn() == 1 {
+		return fmt.Errorf("must take the world as its first argument after the context")
+	}
+	if fnType.NumIn() == 0 {
+		return fmt.Errorf("must take the world as its first argument")
+	}
+	returnsError := fnType.NumOut() == 1 && fnType.Out(0) == errorType
+	returnsContext := fnType.NumOut() == 2 && fnType.Out(0) == contextType && fnType.Out(1) == errorType
+	if !returnsError && !returnsContext {
+		return fmt.Errorf("must return an error or (context.Context, error) but returns %s", returnTypes(fnType))
 	}
+	return nil
+}
+
+// validateHookFn checks that a hook has a function
+func validateHookFn(fn interface{}) error {
+	if reflect.ValueOf(fn).IsNil() {
+		return fmt.Errorf("has no function")
+	}
+	return nil
+}
+
+func returnTypes(fnType reflect.Type) string {
+	types := []string{}
+	for index := 0; index < fnType.NumOut(); index++ {
+		types = append(types, fnType.Out(index).String())
+	}
+	if len(types) == 0 {
+		return "nothing"
+	}
+	return "(" + strings.Join(types, ", ") + ")"
+}
+
+// callerLocation returns the file:line of the caller skip frames above the
+// function calling it, relative to the working directory when possible
+func callerLocation(skip int) string {
+	_, file, line, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return "unknown"
+	}
+	if wd, err := os.Getwd(); err == nil {
+		if relative, err := filepath.Rel(wd, file); err == nil && !strings.HasPrefix(relative, "..") {
+			file = relative
+		}
+	}
+	return fmt.Sprintf("%s:%d", file, line)
 }
 
 type ExecuteParams struct {
 	FeaturesPath string
-	Tags         []string
-	Formatter    string
+	// Tags are tag expressions such as "@smoke and not @slow", a test case is
+	// run if it matches all of them
+	Tags      []string
+	Formatter string
+	// FailFast cancels the run after the first failed test case, the test
+	// cases after it are skipped
+	FailFast bool
+	// HandleSignals stops the run gracefully on an interrupt or termination
+	// signal: the running step is interrupted, the test cases not started yet
+	// are skipped and the After and AfterAll hooks still run. It takes over the
+	// handling of these signals for the duration of the run.
+	HandleSignals bool
+	// StepTimeout limits the time every step and Before or After hook may run
+	// unless a @timeout(30s) tag of the scenario or the step definition sets
+	// another timeout. There is no limit when it is 0. A step that ignores its
+	// context keeps running in the background once it timed out.
+	StepTimeout time.Duration
 }
 
-func (c *Cucumber) Execute(params *ExecuteParams) error {
+// Execute runs the features found at params.FeaturesPath and returns a
+// summary of the run. A non nil error means the run could not complete.
+func (c *Cucumber) Execute(params *ExecuteParams) (*RunSummary, error) {
+	errors := append(append([]error{}, c.errors...), c.compileStepDefinitions()...)
+	if len(errors) > 0 {
+		description := ""
+		for _, err := range errors {
+			description += "\n    " + err.Error()
+		}
+		return nil, &CucumberError{
+			Name:        "Invalid Step Definitions or Hooks",
+			Description: fmt.Sprintf("%d registrations must be fixed before running:%s", len(errors), description),
+		}
+	}
+
+	tagExpression, err := parseTagExpressions(params.Tags)
+	if err != nil {
+		return nil, err
+	}
+
 	files, err := c.load(params.FeaturesPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	featureFiles, err := c.parse(files)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	pickles, err := c.compile(featureFiles)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	testCases, err := c.compose(pickles, params.Tags)
+	testCases, err := c.compose(pickles, tagExpression, params.StepTimeout)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	runner := NewRunner(c.World, testCases, c.eventBus)
-
-	err = runner.ExecuteAllTestCases()
-	if err != nil {
-		if cerr, ok := err.(*CucumberError); ok {
-			println(cerr.Name)
-			println(cerr.Description)
-		} else {
-			return err
-		}
+	// the BeforeAll and AfterAll hooks have no world of a test case to share
+	runWorld := c.World
+	if c.WorldFactory != nil {
+		runWorld = nil
 	}
-	return nil
+	runner := NewRunner(runWorld, testCases, c.beforeAllHooks, c.afterAllHooks, c.eventBus)
+	runner.failFast = params.FailFast
+	runner.handleSignals = params.HandleSignals
+
+	return runner.ExecuteAllTestCases()
 }
 
 func (c *Cucumber) compile(featureFiles []*featureFile) ([]*Pickle, error) {
@@ -187,10 +483,10 @@ func (c *Cucumber) parse(files []*file) ([]*featureFile, error) {
 	return featureFiles, nil
 }
 
-func (c *Cucumber) compose(pickles []*Pickle, tags []string) ([]*TestCase, error) {
+func (c *Cucumber) compose(pickles []*Pickle, tagExpression TagExpression, stepTimeout time.Duration) ([]*TestCase, error) {
 	testCases := []*TestCase{}
 	for _, pickle := range pickles {
-		testCase, err := c.composeScenario(pickle, tags)
+		testCase, err := c.composeScenario(pickle, tagExpression, stepTimeout)
 		if err != nil {
 			return nil, err
 		}
@@ -198,18 +494,6 @@ func (c *Cucumber) compose(pickles []*Pickle, tags []string) ([]*TestCase, error
 			testCases = append(testCases, testCase)
 		}
 	}
-	testCount := len(testCases)
-	if testCount > 0 {
-		firstTestCase := testCases[0]
-		lastTestCase := testCases[testCount-1]
-		for _, hook := range c.beforeAllHooks {
-			firstTestCase.BeforeHooks = append([]BeforeHook{hook.fn.(BeforeHook)}, firstTestCase.BeforeHooks...)
-		}
-		for _, hook := range c.afterAllHooks {
-			lastTestCase.AfterHooks = append(lastTestCase.AfterHooks, hook.fn.(AfterHook))
-		}
-	}
-
 	return testCases, nil
 }
 
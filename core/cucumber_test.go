@@ -0,0 +1,91 @@
+package core
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// previousLine returns the line before the line calling it
+func previousLine() int {
+	_, _, line, _ := runtime.Caller(1)
+	return line - 1
+}
+
+func TestRegistrationErrors(t *testing.T) {
+	c := NewCucumber()
+	expected := []string{}
+	c.Step()("a step", nil)
+	expected = append(expected, fmt.Sprintf("cucumber_test.go:%d: step definition \"a step\" has no function", previousLine()))
+	c.Step()("a step", func(world interface{}) {})
+	expected = append(expected, fmt.Sprintf("cucumber_test.go:%d: step definition \"a step\" must return an error or (context.Context, error) but returns nothing", previousLine()))
+	c.Step()("a step (", func(world interface{}) error { return nil })
+	expected = append(expected, fmt.Sprintf("cucumber_test.go:%d: invalid step definition:", previousLine()))
+	c.Before(nil)
+	expected = append(expected, fmt.Sprintf("cucumber_test.go:%d: Before hook has no function", previousLine()))
+	c.After(func(world interface{}) error { return nil }, "@a and")
+	expected = append(expected, fmt.Sprintf("cucumber_test.go:%d: After hook has invalid tags:", previousLine()))
+	c.AddTransform("color", &Transform{
+		Transformer: func(value string) (interface{}, error) { return value, nil },
+	})
+	expected = append(expected, fmt.Sprintf("cucumber_test.go:%d: transform \"color\" has no capture regexp", previousLine()-2))
+	// the parameter count is checked once the step definitions are compiled
+	c.Step()("{int} and {int}", func(world interface{}, value int) error { return nil })
+	expected = append(expected, fmt.Sprintf("cucumber_test.go:%d: step definition \"{int} and {int}\" has 2 parameters but its function takes 1 arguments after the world", previousLine()))
+
+	_, err := c.Execute(&ExecuteParams{
+		FeaturesPath: "does-not-exist",
+	})
+	cucumberErr, ok := err.(*CucumberError)
+	if !ok || cucumberErr.Name != "Invalid Step Definitions or Hooks" {
+		t.Fatalf("expected the registration errors but got %v", err)
+	}
+	lines := strings.Split(cucumberErr.Description, "\n")
+	if lines[0] != fmt.Sprintf("%d registrations must be fixed before running:", len(expected)) || len(lines) != len(expected)+1 {
+		t.Fatalf("expected %d registration errors but got\n%s", len(expected), cucumberErr.Description)
+	}
+	for index, item := range expected {
+		if !strings.HasPrefix(strings.TrimSpace(lines[index+1]), item) {
+			t.Errorf("expected the error %q but got %q", item, strings.TrimSpace(lines[index+1]))
+		}
+	}
+}
+
+func TestLazyCompilation(t *testing.T) {
+	c := NewCucumber()
+	colors := []string{}
+	c.Step()("a {c:color} car", func(world interface{}, color string) error {
+		colors = append(colors, color)
+		return nil
+	})
+	// the transform is registered after the step definition using it
+	c.AddTransform("color", &Transform{
+		CaptureRegexp: "red|blue",
+		Transformer: func(value string) (interface{}, error) {
+			return strings.ToUpper(value), nil
+		},
+	})
+	summary, err := runFeature(t, c, `Feature: lazy
+  Scenario: first
+    Given a red car
+`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Failed() || len(colors) != 1 || colors[0] != "RED" {
+		t.Errorf("expected the step to use the transform registered after it but got %v", colors)
+	}
+
+	c = NewCucumber()
+	c.Step()("a {c:colour} car", func(world interface{}, color string) error { return nil })
+	line := previousLine()
+	_, err = runFeature(t, c, `Feature: lazy
+  Scenario: first
+    Given a red car
+`, nil)
+	expected := fmt.Sprintf("cucumber_test.go:%d: step definition \"a {c:colour} car\" has a {c:colour} parameter but no transform is registered for the type colour", line)
+	if cucumberErr, ok := err.(*CucumberError); !ok || !strings.Contains(cucumberErr.Description, expected) {
+		t.Errorf("expected the error %q but got %v", expected, err)
+	}
+}
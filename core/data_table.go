@@ -0,0 +1,203 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/cucumber/gherkin-go"
+)
+
+// DataTable is the table argument of a step. It is passed to the step
+// definition as its last argument.
+type DataTable struct {
+	rows [][]string
+}
+
+// NewDataTable creates a DataTable from its raw rows
+func NewDataTable(rows [][]string) *DataTable {
+	return &DataTable{
+		rows: rows,
+	}
+}
+
+func newDataTableFromGherkin(node *gherkin.DataTable) *DataTable {
+	rows := [][]string{}
+	for _, row := range node.Rows {
+		cells := []string{}
+		for _, cell := range row.Cells {
+			cells = append(cells, cell.Value)
+		}
+		rows = append(rows, cells)
+	}
+	return NewDataTable(rows)
+}
+
+// Raw returns every row of the table including the header row
+func (t *DataTable) Raw() [][]string {
+	return t.rows
+}
+
+// Header returns the first row of the table
+func (t *DataTable) Header() []string {
+	if len(t.rows) == 0 {
+		return []string{}
+	}
+	return t.rows[0]
+}
+
+// Rows returns the rows of the table without the header row
+func (t *DataTable) Rows() [][]string {
+	if len(t.rows) == 0 {
+		return [][]string{}
+	}
+	return t.rows[1:]
+}
+
+// Hashes returns a map for every row but the header row, keyed by the cells of
+// the header row
+func (t *DataTable) Hashes() []map[string]string {
+	header := t.Header()
+	hashes := []map[string]string{}
+	for _, row := range t.Rows() {
+		hash := map[string]string{}
+		for index, cell := range row {
+			if index < len(header) {
+				hash[header[index]] = cell
+			}
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes
+}
+
+// RowsHash returns a map of the first column to the second column of a two
+// column table
+func (t *DataTable) RowsHash() (map[string]string, error) {
+	hash := map[string]string{}
+	for index, row := range t.rows {
+		if len(row) != 2 {
+			return nil, fmt.Errorf("RowsHash requires a table with 2 columns but row %d has %d columns", index+1, len(row))
+		}
+		hash[row[0]] = row[1]
+	}
+	return hash, nil
+}
+
+// Transpose returns a new table with the rows and columns swapped
+func (t *DataTable) Transpose() *DataTable {
+	columns := 0
+	for _, row := range t.rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+	rows := make([][]string, columns)
+	for index := range rows {
+		rows[index] = make([]string, len(t.rows))
+		for rowIndex, row := range t.rows {
+			if index < len(row) {
+				rows[index][rowIndex] = row[index]
+			}
+		}
+	}
+	return NewDataTable(rows)
+}
+
+// canUnmarshal reports whether a table can be unmarshaled into a step
+// definition parameter of the given type
+func (t *DataTable) canUnmarshal(target reflect.Type) bool {
+	if target.Kind() == reflect.Slice {
+		return isStructType(target.Elem())
+	}
+	return isStructType(target) && target != reflect.TypeOf(t)
+}
+
+// unmarshal converts the table into a slice of structs or struct pointers,
+// with a struct per row keyed by the header row, or for a vertical table of
+// field names and values into a single struct. Cells are converted with the
+// transform of the type of their field.
+func (t *DataTable) unmarshal(target reflect.Type, transformLookup map[string]*Transform) (reflect.Value, error) {
+	if target.Kind() != reflect.Slice {
+		if _, err := t.RowsHash(); err != nil {
+			return reflect.Value{}, err
+		}
+		transposed := t.Transpose()
+		row := []string{}
+		if len(transposed.Rows()) > 0 {
+			row = transposed.Rows()[0]
+		}
+		return transposed.unmarshalRow(transposed.Header(), row, target, transformLookup)
+	}
+	header := t.Header()
+	result := reflect.MakeSlice(target, 0, len(t.Rows()))
+	for index, row := range t.Rows() {
+		item, err := t.unmarshalRow(header, row, target.Elem(), transformLookup)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("row %d: %s", index+2, err)
+		}
+		result = reflect.Append(result, item)
+	}
+	return result, nil
+}
+
+func (t *DataTable) unmarshalRow(header []string, row []string, target reflect.Type, transformLookup map[string]*Transform) (reflect.Value, error) {
+	structType := target
+	if target.Kind() == reflect.Ptr {
+		structType = target.Elem()
+	}
+	fields := tableFields(structType)
+	structValue := reflect.New(structType)
+	for index, cell := range row {
+		if index >= len(header) {
+			break
+		}
+		fieldIndex, ok := fields[normalizeColumnName(header[index])]
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("column %q does not match any field of %s", header[index], structType)
+		}
+		field := structValue.Elem().Field(fieldIndex)
+		value, err := transformText(cell, field.Type(), transformLookup)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("cell %q of column %q cannot be converted to %s: %s", cell, header[index], field.Type(), err)
+		}
+		field.Set(value)
+	}
+	if target.Kind() == reflect.Ptr {
+		return structValue, nil
+	}
+	return structValue.Elem(), nil
+}
+
+func isStructType(target reflect.Type) bool {
+	if target.Kind() == reflect.Ptr {
+		target = target.Elem()
+	}
+	return target.Kind() == reflect.Struct
+}
+
+// tableFields maps the normalized column names of the exported fields of a
+// struct to their field index. A `table:"name"` struct tag overrides the
+// column name of a field and `table:"-"` leaves the field out.
+func tableFields(structType reflect.Type) map[string]int {
+	fields := map[string]int{}
+	for index := 0; index < structType.NumField(); index++ {
+		field := structType.Field(index)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Name
+		if tag := field.Tag.Get("table"); tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		fields[normalizeColumnName(name)] = index
+	}
+	return fields
+}
+
+// normalizeColumnName makes "First Name", "first_name" and "FirstName" match
+func normalizeColumnName(name string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "_", "", "-", "").Replace(name))
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestDataTable(t *testing.T) {
+	table := NewDataTable([][]string{
+		{"name", "age"},
+		{"alice", "30"},
+		{"bob", "25"},
+	})
+
+	hashes := table.Hashes()
+	expectedHashes := []map[string]string{
+		{"name": "alice", "age": "30"},
+		{"name": "bob", "age": "25"},
+	}
+	if !reflect.DeepEqual(hashes, expectedHashes) {
+		t.Errorf("expected hashes %v but got %v", expectedHashes, hashes)
+	}
+
+	transposed := table.Transpose().Raw()
+	expectedTransposed := [][]string{
+		{"name", "alice", "bob"},
+		{"age", "30", "25"},
+	}
+	if !reflect.DeepEqual(transposed, expectedTransposed) {
+		t.Errorf("expected transposed table %v but got %v", expectedTransposed, transposed)
+	}
+
+	rowsHash, err := table.RowsHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rowsHash["alice"] != "30" || len(rowsHash) != 3 {
+		t.Errorf("unexpected rows hash %v", rowsHash)
+	}
+
+	_, err = table.Transpose().RowsHash()
+	if err == nil {
+		t.Errorf("expected RowsHash to fail on a table with 3 columns")
+	}
+}
+
+func TestDataTableUnmarshal(t *testing.T) {
+	type user struct {
+		Name      string
+		Age       int
+		FirstName string `table:"first name"`
+	}
+	transformLookup := map[string]*Transform{
+		"int": &Transform{
+			CaptureRegexp: "-?\\d+",
+			Transformer: func(value string) (interface{}, error) {
+				return strconv.ParseInt(value, 10, 64)
+			},
+		},
+	}
+
+	table := NewDataTable([][]string{
+		{"name", "age", "first name"},
+		{"alice", "30", "Alice"},
+	})
+	users, err := table.unmarshal(reflect.TypeOf([]*user{}), transformLookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*user{{Name: "alice", Age: 30, FirstName: "Alice"}}
+	if !reflect.DeepEqual(users.Interface(), expected) {
+		t.Errorf("expected %v but got %v", expected, users.Interface())
+	}
+
+	vertical := NewDataTable([][]string{
+		{"name", "bob"},
+		{"age", "25"},
+	})
+	single, err := vertical.unmarshal(reflect.TypeOf(user{}), transformLookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if single.Interface() != (user{Name: "bob", Age: 25}) {
+		t.Errorf("unexpected user %v", single.Interface())
+	}
+
+	_, err = NewDataTable([][]string{{"nickname"}, {"al"}}).unmarshal(reflect.TypeOf([]user{}), transformLookup)
+	if err == nil {
+		t.Errorf("expected an error for an unknown column")
+	}
+
+	_, err = NewDataTable([][]string{{"age"}, {"old"}}).unmarshal(reflect.TypeOf([]user{}), transformLookup)
+	if err == nil {
+		t.Errorf("expected an error for a cell that cannot be converted")
+	}
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/cucumber/gherkin-go"
+)
+
+// DocString is the doc string argument of a step. It is passed to the step
+// definition as its last argument, either as a *DocString, as a string or
+// []byte holding its content or, for a JSON doc string, decoded into the
+// struct, map or slice the step definition declares.
+type DocString struct {
+	Content   string
+	MediaType string
+	// Line is the line of the feature file the doc string starts at
+	Line int
+}
+
+func newDocStringFromGherkin(node *gherkin.DocString) *DocString {
+	docString := &DocString{
+		Content:   node.Content,
+		MediaType: node.ContentType,
+	}
+	if node.Location != nil {
+		docString.Line = node.Location.Line
+	}
+	return docString
+}
+
+// IsJSON reports whether the media type of the doc string is JSON, as in
+// """json or """application/vnd.api+json
+func (d *DocString) IsJSON() bool {
+	mediaType := strings.ToLower(strings.TrimSpace(d.MediaType))
+	return mediaType == "json" || strings.HasSuffix(mediaType, "/json") || strings.HasSuffix(mediaType, "+json")
+}
+
+// canDecode reports whether the doc string can be decoded into a step
+// definition parameter of the given type. A []byte parameter receives the
+// raw content instead.
+func (d *DocString) canDecode(target reflect.Type) bool {
+	if !d.IsJSON() || isBytes(target) {
+		return false
+	}
+	if target.Kind() == reflect.Ptr {
+		target = target.Elem()
+	}
+	switch target.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice:
+		return true
+	}
+	return false
+}
+
+// isBytes reports whether a type is a byte slice such as []byte
+func isBytes(target reflect.Type) bool {
+	return target.Kind() == reflect.Slice && target.Elem().Kind() == reflect.Uint8
+}
+
+func (d *DocString) decode(target reflect.Type) (reflect.Value, error) {
+	value := reflect.New(target)
+	err := json.Unmarshal([]byte(d.Content), value.Interface())
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return value.Elem(), nil
+}
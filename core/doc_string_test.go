@@ -0,0 +1,39 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDocStringConvert(t *testing.T) {
+	type payload struct {
+		Name string `json:"name"`
+	}
+	testCase := &TestCase{
+		Pickle: &Pickle{},
+	}
+	docString := &DocString{
+		Content:   `{"name": "alice"}`,
+		MediaType: "json",
+	}
+	cases := []struct {
+		target   interface{}
+		expected interface{}
+	}{
+		{"", `{"name": "alice"}`},
+		{[]byte{}, []byte(`{"name": "alice"}`)},
+		{payload{}, payload{"alice"}},
+		{map[string]string{}, map[string]string{"name": "alice"}},
+	}
+	for _, item := range cases {
+		target := reflect.TypeOf(item.target)
+		result, err := testCase.convertArgument(docString, target)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", target, err)
+			continue
+		}
+		if !reflect.DeepEqual(result.Interface(), item.expected) {
+			t.Errorf("%s: expected %v but got %v", target, item.expected, result.Interface())
+		}
+	}
+}
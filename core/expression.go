@@ -1,87 +1,488 @@
 package core
 
 import (
-	//"fmt"
+	"fmt"
 	"regexp"
 	"strings"
+	"unicode"
 )
 
-var variablePattern = regexp.MustCompile("\\{([^}:]+)(:([^}]+))?}")
-var paramPattern = regexp.MustCompile("\"[^\"]+\"")
-
 type argument struct {
 	offset           int
 	value            string
 	transformedValue interface{}
+	// err is the error of the transform of the argument, which fails the step
+	err error
 }
 
 type CucumberExpression struct {
 	transforms []*Transform
-	Rawexp     string
-	Regexp     *regexp.Regexp
+	// groups are the indexes of the capture groups of the arguments, capture
+	// groups nested in them are not arguments
+	groups []int
+	Source string
+	Rawexp string
+	Regexp *regexp.Regexp
 }
 
-func (e *CucumberExpression) match(text string) (bool, []*argument, error) {
+func (e *CucumberExpression) match(text string) (bool, []*argument) {
 	arguments := []*argument{}
 
-	matches := e.Regexp.FindAllStringSubmatch(text, -1)
-	if len(matches) == 0 {
-		return e.Regexp.MatchString(text), nil, nil
+	match := e.Regexp.FindStringSubmatchIndex(text)
+	if match == nil {
+		return false, nil
 	}
-	for index, match := range matches[0] {
-		if index < 1 {
+	for index, group := range e.groups {
+		start, end := match[2*group], match[2*group+1]
+		if start < 0 {
+			// an optional group that did not take part in the match
+			arguments = append(arguments, &argument{
+				offset: -1,
+			})
 			continue
 		}
-		offset := strings.Index(text, match)
-		transformedValue, err := e.transforms[index-1].Transformer(match)
+		// the capture groups nested in the argument are passed to its transform
+		next := len(match) / 2
+		if index+1 < len(e.groups) {
+			next = e.groups[index+1]
+		}
+		groups := []string{}
+		for inner := group + 1; inner < next; inner++ {
+			if match[2*inner] < 0 {
+				groups = append(groups, "")
+				continue
+			}
+			groups = append(groups, text[match[2*inner]:match[2*inner+1]])
+		}
+		value := text[start:end]
+		transformedValue, err := e.transforms[index].transform(value, groups)
 		if err != nil {
-			return true, nil, err
+			err = fmt.Errorf("cannot transform %q: %s", value, err)
 		}
 		arguments = append(arguments, &argument{
-			offset:           offset,
-			value:            match,
+			offset:           start,
+			value:            value,
 			transformedValue: transformedValue,
+			err:              err,
 		})
 	}
-	return true, arguments, nil
+	return true, arguments
 }
 
-func newCucumberExpression(expression string, targetTypes []string, transformLookup map[string]*Transform) *CucumberExpression {
-	e := &CucumberExpression{}
-	sb := "^"
-	typeNameIndex := 0
-	matches := variablePattern.FindAllStringSubmatch(expression, -1)
-	matchIndexes := variablePattern.FindAllStringSubmatchIndex(expression, -1)
-	lastIndex := 0
-	for index := 0; index < len(matches); index++ {
-		matchIndex := matchIndexes[index]
-		expressionTypeName := matches[index][3]
-		targetType := ""
-		if len(targetTypes) <= typeNameIndex {
-			targetType = ""
-		} else {
-			targetType = targetTypes[typeNameIndex]
-			typeNameIndex++
-		}
-		var transform *Transform
-		if expressionTypeName != "" {
-			transform = transformLookup[expressionTypeName]
-		} else if targetType != "" {
-			transform = transformLookup[targetType]
-		} else {
-			transform = transformLookup["string"]
+// ArgumentIndexes returns the start and end index in the text of every
+// argument matched by the expression, or nil for an argument that did not
+// take part in the match
+func (e *CucumberExpression) ArgumentIndexes(text string) [][]int {
+	match := e.Regexp.FindStringSubmatchIndex(text)
+	if match == nil {
+		return nil
+	}
+	indexes := [][]int{}
+	for _, group := range e.groups {
+		if match[2*group] < 0 {
+			indexes = append(indexes, nil)
+			continue
 		}
-		e.transforms = append(e.transforms, transform)
+		indexes = append(indexes, match[2*group:2*group+2])
+	}
+	return indexes
+}
 
-		text := regexp.QuoteMeta(expression[lastIndex:matchIndex[0]])
-		captureRegexp := "(" + transform.CaptureRegexp + ")"
-		lastIndex = matchIndex[1]
-		sb += text
-		sb += captureRegexp
+// newCucumberExpression compiles a parsed expression to a regexp. Every
+// parameter captures with the transform of its target type, parameters
+// without one capture strings.
+func newCucumberExpression(tree *expressionTree, targetTypes []string, transformLookup map[string]*Transform) *CucumberExpression {
+	e := &CucumberExpression{
+		Source: tree.source,
+	}
+	sb := "^"
+	for _, node := range tree.nodes {
+		sb += e.compileNode(node, targetTypes, transformLookup)
 	}
-	sb += regexp.QuoteMeta(expression[lastIndex:])
 	sb += "$"
 	e.Rawexp = sb
 	e.Regexp = regexp.MustCompile(sb)
 	return e
 }
+
+func (e *CucumberExpression) compileNode(node *expressionNode, targetTypes []string, transformLookup map[string]*Transform) string {
+	switch node.nodeType {
+	case optionalNode:
+		return "(?:" + e.compileNodes(node.nodes, targetTypes, transformLookup) + ")?"
+	case alternationNode:
+		alternatives := []string{}
+		for _, alternative := range node.nodes {
+			alternatives = append(alternatives, e.compileNodes(alternative.nodes, targetTypes, transformLookup))
+		}
+		return "(?:" + strings.Join(alternatives, "|") + ")"
+	case parameterNode:
+		targetType := ""
+		if len(e.transforms) < len(targetTypes) {
+			targetType = targetTypes[len(e.transforms)]
+		}
+		transform, ok := transformLookup[targetType]
+		if !ok {
+			transform, ok = transformLookup[""]
+		}
+		if !ok {
+			transform = stringTransform
+		}
+		e.groups = append(e.groups, e.groupCount()+1)
+		e.transforms = append(e.transforms, transform)
+		return "(" + transform.captureRegexp() + ")"
+	}
+	return regexp.QuoteMeta(node.text)
+}
+
+// groupCount returns the number of capture groups of the arguments compiled
+// so far, including the groups of their capture regexps
+func (e *CucumberExpression) groupCount() int {
+	if len(e.groups) == 0 {
+		return 0
+	}
+	last := e.transforms[len(e.transforms)-1]
+	return e.groups[len(e.groups)-1] + last.groupCount()
+}
+
+func (e *CucumberExpression) compileNodes(nodes []*expressionNode, targetTypes []string, transformLookup map[string]*Transform) string {
+	sb := ""
+	for _, node := range nodes {
+		sb += e.compileNode(node, targetTypes, transformLookup)
+	}
+	return sb
+}
+
+// CucumberExpressionError is a syntax error in a step definition expression.
+// Column is the 1-based position of the offending character.
+type CucumberExpressionError struct {
+	Expression string
+	Column     int
+	Message    string
+}
+
+func (e *CucumberExpressionError) Error() string {
+	return fmt.Sprintf("Cucumber expression %q has a problem at column %d: %s", e.Expression, e.Column, e.Message)
+}
+
+type expressionNodeType int
+
+const (
+	textNode expressionNodeType = iota
+	whitespaceNode
+	optionalNode
+	alternationNode
+	alternativeNode
+	parameterNode
+	// alternationMarkerNode is a '/' before the alternatives are grouped
+	alternationMarkerNode
+)
+
+// expressionNode is a node of a parsed cucumber expression. A parameter
+// written as {name:type} keeps both, {type} and {} leave typeName empty.
+type expressionNode struct {
+	nodeType expressionNodeType
+	text     string
+	typeName string
+	column   int
+	nodes    []*expressionNode
+}
+
+// source returns a parameter node as it is written in the expression
+func (n *expressionNode) source() string {
+	if n.typeName != "" {
+		return "{" + n.text + ":" + n.typeName + "}"
+	}
+	return "{" + n.text + "}"
+}
+
+type expressionTree struct {
+	source string
+	nodes  []*expressionNode
+}
+
+// parameters returns the parameter nodes of the expression in order
+func (t *expressionTree) parameters() []*expressionNode {
+	parameters := []*expressionNode{}
+	for _, node := range t.nodes {
+		if node.nodeType == parameterNode {
+			parameters = append(parameters, node)
+		}
+	}
+	return parameters
+}
+
+// parseCucumberExpression parses the Cucumber Expressions syntax: parameters
+// such as {int}, {name:type} or the anonymous {}, optional text such as
+// cucumber(s), alternative text such as color/colour and backslash escapes
+// of '(', ')', '{', '}', '/', '\' and whitespace.
+func parseCucumberExpression(expression string) (*expressionTree, error) {
+	parser := &expressionParser{
+		expression: expression,
+		runes:      []rune(expression),
+	}
+	nodes := []*expressionNode{}
+	for parser.position < len(parser.runes) {
+		node, err := parser.parseNode()
+		if err != nil {
+			return nil, err
+		}
+		nodes = appendExpressionNode(nodes, node)
+	}
+	nodes, err := parser.groupAlternations(nodes)
+	if err != nil {
+		return nil, err
+	}
+	return &expressionTree{
+		source: expression,
+		nodes:  nodes,
+	}, nil
+}
+
+// appendExpressionNode appends a node, merging adjacent text
+func appendExpressionNode(nodes []*expressionNode, node *expressionNode) []*expressionNode {
+	if len(nodes) > 0 {
+		last := nodes[len(nodes)-1]
+		if last.nodeType == node.nodeType && (node.nodeType == textNode || node.nodeType == whitespaceNode) {
+			last.text += node.text
+			return nodes
+		}
+	}
+	return append(nodes, node)
+}
+
+type expressionParser struct {
+	expression string
+	runes      []rune
+	position   int
+}
+
+func (p *expressionParser) error(column int, message string) error {
+	return &CucumberExpressionError{
+		Expression: p.expression,
+		Column:     column,
+		Message:    message,
+	}
+}
+
+// parseNode parses the node at the current position of the top level of the
+// expression
+func (p *expressionParser) parseNode() (*expressionNode, error) {
+	char := p.runes[p.position]
+	column := p.position + 1
+	switch {
+	case char == '{':
+		return p.parseParameter()
+	case char == '(':
+		return p.parseOptional()
+	case char == '/':
+		p.position++
+		return &expressionNode{
+			nodeType: alternationMarkerNode,
+			text:     "/",
+			column:   column,
+		}, nil
+	case unicode.IsSpace(char):
+		p.position++
+		return &expressionNode{
+			nodeType: whitespaceNode,
+			text:     string(char),
+			column:   column,
+		}, nil
+	}
+	text, err := p.parseChar()
+	if err != nil {
+		return nil, err
+	}
+	return &expressionNode{
+		nodeType: textNode,
+		text:     text,
+		column:   column,
+	}, nil
+}
+
+// parseChar consumes a character, resolving a backslash escape
+func (p *expressionParser) parseChar() (string, error) {
+	char := p.runes[p.position]
+	p.position++
+	if char != '\\' {
+		return string(char), nil
+	}
+	if p.position >= len(p.runes) {
+		return "", p.error(p.position, "expected a character to escape after '\\'")
+	}
+	escaped := p.runes[p.position]
+	if !strings.ContainsRune("(){}/\\", escaped) && !unicode.IsSpace(escaped) {
+		return "", p.error(p.position, fmt.Sprintf("only '(', ')', '{', '}', '/', '\\' and whitespace can be escaped but found %q", escaped))
+	}
+	p.position++
+	return string(escaped), nil
+}
+
+func (p *expressionParser) parseParameter() (*expressionNode, error) {
+	start := p.position + 1
+	p.position++
+	name := ""
+	for {
+		if p.position >= len(p.runes) {
+			return nil, p.error(start, "the '{' does not have a matching '}'")
+		}
+		char := p.runes[p.position]
+		if char == '}' {
+			p.position++
+			break
+		}
+		if strings.ContainsRune("{()/", char) {
+			return nil, p.error(p.position+1, fmt.Sprintf("parameter names may not contain %q", char))
+		}
+		text, err := p.parseChar()
+		if err != nil {
+			return nil, err
+		}
+		name += text
+	}
+	node := &expressionNode{
+		nodeType: parameterNode,
+		text:     name,
+		column:   start,
+	}
+	if index := strings.Index(name, ":"); index >= 0 {
+		node.text = name[:index]
+		node.typeName = name[index+1:]
+		if node.typeName == "" {
+			return nil, p.error(start, fmt.Sprintf("parameter {%s} has an empty type", name))
+		}
+	}
+	return node, nil
+}
+
+func (p *expressionParser) parseOptional() (*expressionNode, error) {
+	start := p.position + 1
+	p.position++
+	node := &expressionNode{
+		nodeType: optionalNode,
+		column:   start,
+	}
+	for {
+		if p.position >= len(p.runes) {
+			return nil, p.error(start, "the '(' does not have a matching ')'")
+		}
+		char := p.runes[p.position]
+		column := p.position + 1
+		switch char {
+		case ')':
+			p.position++
+			if len(node.nodes) == 0 {
+				return nil, p.error(start, "an optional must contain some text")
+			}
+			return node, nil
+		case '{':
+			return nil, p.error(column, "an optional may not contain a parameter")
+		case '(':
+			return nil, p.error(column, "an optional may not contain an other optional")
+		case '/':
+			return nil, p.error(column, "an optional may not contain an alternation, escape the '/' to match it literally")
+		}
+		text, err := p.parseChar()
+		if err != nil {
+			return nil, err
+		}
+		node.nodes = appendExpressionNode(node.nodes, &expressionNode{
+			nodeType: textNode,
+			text:     text,
+			column:   column,
+		})
+	}
+}
+
+// groupAlternations turns the text and optionals around '/' into an
+// alternation. Alternations are bounded by whitespace, parameters and the
+// ends of the expression.
+func (p *expressionParser) groupAlternations(nodes []*expressionNode) ([]*expressionNode, error) {
+	result := []*expressionNode{}
+	segment := []*expressionNode{}
+	flush := func() error {
+		node, err := p.alternation(segment)
+		if err != nil {
+			return err
+		}
+		if node != nil {
+			result = append(result, node)
+		} else {
+			result = append(result, segment...)
+		}
+		segment = []*expressionNode{}
+		return nil
+	}
+	for _, node := range nodes {
+		if node.nodeType == whitespaceNode || node.nodeType == parameterNode {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			if node.nodeType == whitespaceNode {
+				node.nodeType = textNode
+			}
+			result = append(result, node)
+			continue
+		}
+		segment = append(segment, node)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// alternation returns the alternation node of a segment between boundaries
+// or nil if the segment has no '/'
+func (p *expressionParser) alternation(segment []*expressionNode) (*expressionNode, error) {
+	markers := []*expressionNode{}
+	for _, node := range segment {
+		if node.nodeType == alternationMarkerNode {
+			markers = append(markers, node)
+		}
+	}
+	if len(markers) == 0 {
+		return nil, nil
+	}
+	node := &expressionNode{
+		nodeType: alternationNode,
+		column:   segment[0].column,
+	}
+	alternative := &expressionNode{
+		nodeType: alternativeNode,
+		column:   segment[0].column,
+	}
+	add := func(column int) error {
+		hasText := false
+		for _, item := range alternative.nodes {
+			if item.nodeType == textNode {
+				hasText = true
+			}
+		}
+		if len(alternative.nodes) == 0 {
+			return p.error(column, "an alternative may not be empty")
+		}
+		if !hasText {
+			return p.error(alternative.column, "an alternative may not exclusively contain optionals")
+		}
+		node.nodes = append(node.nodes, alternative)
+		return nil
+	}
+	for _, item := range segment {
+		if item.nodeType != alternationMarkerNode {
+			alternative.nodes = append(alternative.nodes, item)
+			continue
+		}
+		if err := add(item.column); err != nil {
+			return nil, err
+		}
+		alternative = &expressionNode{
+			nodeType: alternativeNode,
+			column:   item.column + 1,
+		}
+	}
+	if err := add(markers[len(markers)-1].column); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
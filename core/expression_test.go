@@ -0,0 +1,172 @@
+package core
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func testTransformLookup() map[string]*Transform {
+	return map[string]*Transform{
+		"int": &Transform{
+			CaptureRegexp: "-?\\d+",
+			Transformer: func(value string) (interface{}, error) {
+				return strconv.Atoi(value)
+			},
+		},
+		"string": &Transform{
+			CaptureRegexp: ".+",
+			Transformer: func(value string) (interface{}, error) {
+				return value, nil
+			},
+		},
+	}
+}
+
+func TestCucumberExpressionMatch(t *testing.T) {
+	cases := []struct {
+		expression string
+		text       string
+		match      bool
+		values     []string
+	}{
+		{"I have {int} cucumber(s)", "I have 1 cucumber", true, []string{"1"}},
+		{"I have {int} cucumber(s)", "I have 42 cucumbers", true, []string{"42"}},
+		{"I have {int} cucumber(s)", "I have many cucumbers", false, nil},
+		{"the color/colour is red", "the colour is red", true, nil},
+		{"the color/colour is red", "the color is red", true, nil},
+		{"the color/colour is red", "the colr is red", false, nil},
+		{"I eat {}", "I eat a pie", true, []string{"a pie"}},
+		{"I eat {n:int} pies", "I eat 3 pies", true, []string{"3"}},
+		{"a/b(s)/c", "a bs", false, nil},
+		{"a/b(s)/c", "bs", true, nil},
+		{"half \\/ full", "half / full", true, nil},
+		{"it costs \\(a lot\\)", "it costs (a lot)", true, nil},
+		{"a \\{b}", "a {b}", true, nil},
+		{"one.two*", "one.two*", true, nil},
+		{"smile :)", "smile :)", true, nil},
+	}
+	for _, item := range cases {
+		tree, err := parseCucumberExpression(item.expression)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", item.expression, err)
+			continue
+		}
+		targetTypes := []string{}
+		for _, parameter := range tree.parameters() {
+			typeName := parameter.typeName
+			if typeName == "" {
+				typeName = parameter.text
+			}
+			targetTypes = append(targetTypes, typeName)
+		}
+		expression := newCucumberExpression(tree, targetTypes, testTransformLookup())
+		match, arguments := expression.match(item.text)
+		if match != item.match {
+			t.Errorf("%q with %q: expected %t but got %t", item.expression, item.text, item.match, match)
+			continue
+		}
+		for index, value := range item.values {
+			if index >= len(arguments) || arguments[index].value != value {
+				t.Errorf("%q with %q: expected argument %d to be %q", item.expression, item.text, index, value)
+			}
+		}
+	}
+}
+
+func TestCucumberExpressionSyntaxErrors(t *testing.T) {
+	cases := []struct {
+		expression string
+		column     int
+	}{
+		{"I have {int cucumbers", 8},
+		{"I have (many cucumbers", 8},
+		{"I have () cucumbers", 8},
+		{"I have ({int}) cucumbers", 9},
+		{"I have ((x)) cucumbers", 9},
+		{"I have (a/b) cucumbers", 10},
+		{"I have {a(b)} cucumbers", 10},
+		{"a / b", 3},
+		{"a/ b", 2},
+		{"a/(b) c", 3},
+		{"a\\b", 2},
+		{"a\\", 2},
+	}
+	for _, item := range cases {
+		_, err := parseCucumberExpression(item.expression)
+		if err == nil {
+			t.Errorf("%q: expected a syntax error", item.expression)
+			continue
+		}
+		if syntaxErr, ok := err.(*CucumberExpressionError); !ok || syntaxErr.Column != item.column {
+			t.Errorf("%q: expected a syntax error at column %d but got %s", item.expression, item.column, err)
+		}
+	}
+}
+
+func TestCucumberExpressionGroupTransformer(t *testing.T) {
+	lookup := testTransformLookup()
+	lookup["point"] = &Transform{
+		CaptureRegexps: []string{"(\\d+),(\\d+)", "(\\d+) and (\\d+)"},
+		GroupTransformer: func(groups []string) (interface{}, error) {
+			return strings.Join(groups, "|"), nil
+		},
+	}
+	cases := []struct {
+		text     string
+		expected string
+	}{
+		{"a point at 1,2", "1|2"},
+		{"a point at 3 and 4", "3|4"},
+	}
+	tree, err := parseCucumberExpression("a point at {point}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expression := newCucumberExpression(tree, []string{"point"}, lookup)
+	for _, item := range cases {
+		match, arguments := expression.match(item.text)
+		if !match {
+			t.Errorf("%q: expected a match", item.text)
+			continue
+		}
+		if arguments[0].transformedValue != item.expected {
+			t.Errorf("%q: expected the groups %q but got %q", item.text, item.expected, arguments[0].transformedValue)
+		}
+	}
+}
+
+func TestStringParameter(t *testing.T) {
+	cases := []struct {
+		expression string
+		text       string
+		match      bool
+		expected   string
+	}{
+		{"I order {string}", "I order \"green tea\"", true, "green tea"},
+		{"I order {string}", "I order 'it\\'s tea'", true, "it's tea"},
+		// {string} no longer matches unquoted text, {} does
+		{"I order {string}", "I order green tea", false, ""},
+		{"I order {}", "I order green tea", true, "green tea"},
+	}
+	for _, item := range cases {
+		tree, err := parseCucumberExpression(item.expression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fn := func(world interface{}, value string) error { return nil }
+		targetTypes, err := inferTargetTypes(tree.parameters(), fn, builtinTransforms())
+		if err != nil {
+			t.Fatal(err)
+		}
+		expression := newCucumberExpression(tree, targetTypes, builtinTransforms())
+		match, arguments := expression.match(item.text)
+		if match != item.match {
+			t.Errorf("%q with %q: expected %t but got %t", item.expression, item.text, item.match, match)
+			continue
+		}
+		if match && arguments[0].transformedValue != item.expected {
+			t.Errorf("%q with %q: expected %q but got %v", item.expression, item.text, item.expected, arguments[0].transformedValue)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// PanicError is the error a step definition or hook fails with when it panics
+type PanicError struct {
+	Value interface{}
+	// Stack is the stack trace of the panic, trimmed to the frames of the user
+	// code that panicked
+	Stack string
+}
+
+func (e *PanicError) Error() string {
+	if e.Stack == "" {
+		return fmt.Sprintf("panic: %v", e.Value)
+	}
+	return fmt.Sprintf("panic: %v\n%s", e.Value, e.Stack)
+}
+
+var corePackage = reflect.TypeOf(PanicError{}).PkgPath() + "."
+
+// userCodeCallers are the functions calling into user code, which recover its
+// panics with capturePanic
+var userCodeCallers = map[string]bool{
+	corePackage + "callStepDefinition":          true,
+	corePackage + "callHook":                    true,
+	corePackage + "callAroundHook":              true,
+	corePackage + "(*TestCase).newWorld":        true,
+	corePackage + "(*TestCase).convertArgument": true,
+	corePackage + "(*Transform).transform":      true,
+}
+
+// capturePanic recovers a panic and stores it in err as a PanicError. It must
+// be deferred directly by the function calling user code.
+func capturePanic(err *error) {
+	if value := recover(); value != nil {
+		*err = &PanicError{
+			Value: value,
+			Stack: panicStack(),
+		}
+	}
+}
+
+// panicStack returns the frames between the panic and the cucumber function
+// that called into the user code, leaving out the runtime and reflect frames.
+// It must only be called while recovering a panic.
+func panicStack() string {
+	pcs := make([]uintptr, 64)
+	count := runtime.Callers(0, pcs)
+	frames := runtime.CallersFrames(pcs[:count])
+	lines := []string{}
+	panicking := false
+	for {
+		frame, more := frames.Next()
+		if !panicking {
+			// the frames up to the panic are the ones recovering it
+			panicking = frame.Function == "runtime.gopanic"
+		} else if userCodeCallers[frame.Function] {
+			break
+		} else if !strings.HasPrefix(frame.Function, "runtime.") && !strings.HasPrefix(frame.Function, "reflect.") {
+			lines = append(lines, fmt.Sprintf("%s\n\t%s:%d", frame.Function, frame.File, frame.Line))
+		}
+		if !more {
+			break
+		}
+	}
+	return strings.Join(lines, "\n")
+}
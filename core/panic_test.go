@@ -0,0 +1,101 @@
+package core
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func panicInStep(world interface{}) error {
+	var values map[string]int
+	values["key"] = 1
+	return nil
+}
+
+func TestPanicStack(t *testing.T) {
+	cases := []struct {
+		name string
+		call func() error
+	}{
+		{"step definition", func() error {
+			_, err := callStepDefinition(context.Background(), reflect.ValueOf(panicInStep), []reflect.Value{reflect.ValueOf(0)})
+			return err
+		}},
+		{"hook", func() error {
+			_, err := callHook(context.Background(), BeforeHook(panicInStep), nil)
+			return err
+		}},
+		{"around hook", func() error {
+			return callAroundHook(context.Background(), AroundHook(func(world interface{}, next func() error) error {
+				return panicInStep(world)
+			}), nil, nil)
+		}},
+	}
+	for _, item := range cases {
+		panicErr, ok := item.call().(*PanicError)
+		if !ok {
+			t.Errorf("%s: expected a panic error", item.name)
+			continue
+		}
+		lines := strings.Split(panicErr.Stack, "\n")
+		if !strings.HasSuffix(lines[0], ".panicInStep") {
+			t.Errorf("%s: expected the stack to start at the panicking function but got\n%s", item.name, panicErr.Stack)
+		}
+		if strings.Contains(panicErr.Stack, "runtime.") || strings.Contains(panicErr.Stack, "reflect.") || strings.Contains(panicErr.Stack, ".callStepDefinition") {
+			t.Errorf("%s: expected the stack to hold the user frames only but got\n%s", item.name, panicErr.Stack)
+		}
+	}
+}
+
+type panickingText struct{}
+
+func (p *panickingText) UnmarshalText(text []byte) error {
+	panic("cannot parse")
+}
+
+func TestArgumentPanics(t *testing.T) {
+	c := NewCucumber()
+	c.AddTransform("broken", &Transform{
+		CaptureRegexp: "broken",
+		Transformer: func(value string) (interface{}, error) {
+			panic("cannot transform")
+		},
+	})
+	c.Step()("a {broken} transform", func(world interface{}, value interface{}) error {
+		return nil
+	})
+	c.Step()("a text of {}", func(world interface{}, value panickingText) error {
+		return nil
+	})
+	c.Step()("a step", func(world interface{}) error {
+		return nil
+	})
+	errs := map[string]error{}
+	c.AddOuputFormatter(func(event *Event) {
+		if step, ok := event.Data.(*TestStep); ok && event.Name == TestStepFinished && step.PickleStep != nil {
+			errs[step.PickleStep.Text] = step.Result.Error
+		}
+	})
+	summary, err := runFeature(t, c, `Feature: panics
+  Scenario: transform
+    Given a broken transform
+
+  Scenario: text
+    Given a text of anything
+
+  Scenario: other
+    Given a step
+`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range []string{"a broken transform", "a text of anything"} {
+		if errs[text] == nil || !strings.Contains(errs[text].Error(), "panic: cannot") {
+			t.Errorf("%q: expected the panic to fail the step but got %v", text, errs[text])
+		}
+	}
+	if summary.Scenarios[FailedResult] != 2 || summary.Scenarios[PassedResult] != 1 {
+		t.Errorf("expected only the test cases with a panic to fail but got %v", summary.Scenarios)
+	}
+}
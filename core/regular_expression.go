@@ -0,0 +1,122 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+)
+
+// isRegularExpression reports whether a step definition is written as a
+// regular expression rather than a cucumber expression, which is the case
+// when it is anchored with both '^' and '$'
+func isRegularExpression(expression string) bool {
+	return len(expression) > 1 && strings.HasPrefix(expression, "^") && strings.HasSuffix(expression, "$")
+}
+
+// newRegularExpression creates the expression of a step definition written as
+// a regular expression. Every top level capture group is an argument, it is
+// converted with the transform whose capture regexp is the same as the group
+// or else with the transform for the type of the matching function parameter.
+func newRegularExpression(expression string, fn interface{}, transformLookup map[string]*Transform) (*CucumberExpression, error) {
+	compiled, err := regexp.Compile(expression)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := syntax.Parse(expression, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	e := &CucumberExpression{
+		Source: expression,
+		Rawexp: expression,
+		Regexp: compiled,
+	}
+	captures := topLevelCaptures(tree)
+	fnType := reflect.TypeOf(fn)
+	parameterCount := fnType.NumIn() - argumentIndex(fnType)
+	if parameterCount != len(captures) && parameterCount != len(captures)+1 {
+		return nil, fmt.Errorf("has %d capture groups but its function takes %d arguments after the world", len(captures), parameterCount)
+	}
+	for index, capture := range captures {
+		parameterType := fnType.In(argumentIndex(fnType) + index)
+		name := transformNameForCapture(capture.Sub[0], parameterType, transformLookup)
+		if name == "" && parameterType.Kind() != reflect.Interface {
+			name = transformNameForType(parameterType, transformLookup)
+		}
+		transform, ok := transformLookup[name]
+		if !ok {
+			if parameterType.Kind() != reflect.String && parameterType.Kind() != reflect.Interface {
+				return nil, fmt.Errorf("has a capture group (%s) but no transform is registered for its type %s", capture.Sub[0], parameterType)
+			}
+			transform = stringTransform
+		}
+		e.groups = append(e.groups, capture.Cap)
+		e.transforms = append(e.transforms, transform)
+	}
+	return e, nil
+}
+
+// stringTransform passes captured text on unchanged
+var stringTransform = &Transform{
+	CaptureRegexp: ".*",
+	Transformer: func(value string) (interface{}, error) {
+		return value, nil
+	},
+	Type: reflect.TypeOf(""),
+}
+
+// topLevelCaptures returns the capture groups of a regexp that are not nested
+// in another capture group
+func topLevelCaptures(tree *syntax.Regexp) []*syntax.Regexp {
+	if tree.Op == syntax.OpCapture {
+		return []*syntax.Regexp{tree}
+	}
+	captures := []*syntax.Regexp{}
+	for _, sub := range tree.Sub {
+		captures = append(captures, topLevelCaptures(sub)...)
+	}
+	return captures
+}
+
+// transformNameForCapture returns the name of the transform with a regexp
+// that is the same as the given capture group and whose values can be passed
+// to the given parameter type. Transforms preferred for regexp matches win.
+func transformNameForCapture(capture *syntax.Regexp, parameterType reflect.Type, transformLookup map[string]*Transform) string {
+	names := []string{}
+	preferred := []string{}
+	for name, transform := range transformLookup {
+		if !transform.matchesCapture(capture) {
+			continue
+		}
+		if transform.Type != nil && !canConvert(transform.Type, parameterType) {
+			continue
+		}
+		names = append(names, name)
+		if transform.PreferForRegexpMatch {
+			preferred = append(preferred, name)
+		}
+	}
+	if len(preferred) > 0 {
+		names = preferred
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+// matchesCapture reports whether one of the regexps of the transform, or all
+// of them together, is the same as the given capture group
+func (t *Transform) matchesCapture(capture *syntax.Regexp) bool {
+	for _, item := range append(t.regexps(), t.captureRegexp()) {
+		tree, err := syntax.Parse(item, syntax.Perl)
+		if err == nil && tree.String() == capture.String() {
+			return true
+		}
+	}
+	return false
+}
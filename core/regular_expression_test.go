@@ -0,0 +1,102 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIsRegularExpression(t *testing.T) {
+	cases := []struct {
+		expression string
+		expected   bool
+	}{
+		{"^I have (\\d+) cucumbers$", true},
+		{"^I have cucumbers", false},
+		{"I pay {int} for {string} \\(really) $", false},
+		{"^$", true},
+		{"$", false},
+		{"I have {int} cucumbers", false},
+	}
+	for _, item := range cases {
+		if isRegularExpression(item.expression) != item.expected {
+			t.Errorf("%q: expected %t", item.expression, item.expected)
+		}
+	}
+}
+
+func TestRegularExpressionTransforms(t *testing.T) {
+	lookup := builtinTransforms()
+	lookup["color"] = &Transform{
+		CaptureRegexp: "red|blue",
+		Transformer: func(value string) (interface{}, error) {
+			return "color " + value, nil
+		},
+		Type: reflect.TypeOf(""),
+	}
+	lookup["letters"] = &Transform{
+		CaptureRegexp: "[a-z]+",
+		Transformer: func(value string) (interface{}, error) {
+			return "letters " + value, nil
+		},
+	}
+	lookup["preferred letters"] = &Transform{
+		CaptureRegexp: "[a-z]+",
+		Transformer: func(value string) (interface{}, error) {
+			return "preferred " + value, nil
+		},
+		PreferForRegexpMatch: true,
+	}
+	cases := []struct {
+		expression string
+		fn         interface{}
+		text       string
+		expected   interface{}
+		err        bool
+	}{
+		// the capture matches the regexp of int, byte, short and long but int
+		// is preferred
+		{"^I have (-?\\d+) cucumbers$", func(world interface{}, value int64) error { return nil }, "I have 42 cucumbers", 42, false},
+		{"^the (red|blue) car$", func(world interface{}, value string) error { return nil }, "the red car", "color red", false},
+		{"^the ([a-z]+) word$", func(world interface{}, value interface{}) error { return nil }, "the abc word", "preferred abc", false},
+		// a capture matching no transform uses the transform of the parameter
+		// type
+		{"^it waits (.+)$", func(world interface{}, value time.Duration) error { return nil }, "it waits 2s", 2 * time.Second, false},
+		{"^it says (.+)$", func(world interface{}, value string) error { return nil }, "it says hi", "hi", false},
+		{"^it counts (\\d+) and (\\d+)$", func(world interface{}, value int) error { return nil }, "", nil, true},
+	}
+	for _, item := range cases {
+		expression, err := newRegularExpression(item.expression, item.fn, lookup)
+		if item.err {
+			if err == nil {
+				t.Errorf("%q with %T: expected an error", item.expression, item.fn)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q with %T: unexpected error: %s", item.expression, item.fn, err)
+			continue
+		}
+		match, arguments := expression.match(item.text)
+		if !match {
+			t.Errorf("%q: expected %q to match", item.expression, item.text)
+			continue
+		}
+		if arguments[0].err != nil || arguments[0].transformedValue != item.expected {
+			t.Errorf("%q with %q: expected %v but got %v, %v", item.expression, item.text, item.expected, arguments[0].transformedValue, arguments[0].err)
+		}
+	}
+}
+
+func TestSnippetOfAnchoredText(t *testing.T) {
+	c := NewCucumber()
+	text := "I pay 5 for \"tea\" (really) $"
+	snippet, _ := c.compileStepDefinitionText(text)
+	c.Step()(snippet, func(world interface{}, amount int, item string) error { return nil })
+	if len(c.errors) > 0 || len(c.compileStepDefinitions()) > 0 {
+		t.Fatalf("expected the snippet %q to be a valid step definition but got %v", snippet, c.errors)
+	}
+	if match, _ := c.stepDefinitions[0].Expression.match(text); !match {
+		t.Errorf("expected the snippet %q to match %q", snippet, text)
+	}
+}
@@ -1,52 +1,172 @@
 package core
 
 import (
-	"fmt"
-	"strings"
+	"context"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
 type Runner struct {
-	world        interface{}
-	pendingSteps map[string]*TestStep
-	testCases    []*TestCase
-	bus          *EventBus
+	world          interface{}
+	undefinedSteps map[string]bool
+	testCases      []*TestCase
+	beforeAllHooks []*Hook
+	afterAllHooks  []*Hook
+	bus            *EventBus
+	summary        *RunSummary
+	// failFast cancels the run after the first failed test case
+	failFast bool
+	// handleSignals cancels the run on an interrupt or termination signal
+	handleSignals bool
 }
 
-func (r *Runner) ExecuteAllTestCases() error {
+func (r *Runner) ExecuteAllTestCases() (*RunSummary, error) {
 	r.bus.RegisterHandler(TestStepFinished, func(event *Event) {
 		testStep := event.Data.(*TestStep)
-		if testStep.Result == PendingResult {
-			r.pendingSteps[testStep.Text] = testStep
+		if testStep.Type == BeforeAllHookStepType || testStep.Type == AfterAllHookStepType {
+			if testStep.Result.Status == FailedResult {
+				r.summary.FailedHooks = append(r.summary.FailedHooks, testStep)
+			}
+			return
+		}
+		if testStep.Type != PickleStepType {
+			return
+		}
+		r.summary.Steps[testStep.Result.Status]++
+		if testStep.Result.Status == UndefinedResult && !r.undefinedSteps[testStep.Text] {
+			// one snippet per expression, in the order the steps were found
+			r.undefinedSteps[testStep.Text] = true
+			r.summary.Snippets = append(r.summary.Snippets, testStep.snippet())
 		}
 	})
-	r.bus.RegisterHandler(TestRunFinished, func(event *Event) {
-		if len(r.pendingSteps) > 0 {
-			fmt.Printf("You can implement the missing steps with the snippets below:\n\n")
-			for _, step := range r.pendingSteps {
-				if len(step.Arguments) == 0 {
-					fmt.Printf("%s(%q, func(world interface{}) error {\n    // Write your step definition here\n    return nil\n})\n\n", strings.TrimSpace(step.PickleStep.Step.Keyword), step.Text)
-				} else {
-					fmt.Printf("%s(%q, func(world interface{}, text string) error {\n    // Write your step definition here\n    println(text)\n    return nil\n})\n\n", strings.TrimSpace(step.PickleStep.Step.Keyword), step.Text)
-				}
-			}
+	r.bus.RegisterHandler(TestCaseFinished, func(event *Event) {
+		testCase := event.Data.(*TestCase)
+		r.summary.Scenarios[testCase.Result.Status]++
+		if testCase.Result.Status == FailedResult || testCase.Result.Status == AmbiguousResult {
+			r.summary.FailedTestCases = append(r.summary.FailedTestCases, testCase)
 		}
 	})
+	// the run is cancelled with fail fast on the first failure, or when signals
+	// are handled on an interrupt or termination signal, and the test cases not
+	// started by then are skipped. A second signal terminates the process right
+	// away.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var interrupted int32
+	if r.handleSignals {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(signals)
+		finished := make(chan struct{})
+		defer close(finished)
+		go func() {
+			select {
+			case <-signals:
+				atomic.StoreInt32(&interrupted, 1)
+				signal.Stop(signals)
+				cancel()
+			case <-finished:
+			}
+		}()
+	}
+
+	start := time.Now()
 	r.bus.Broadcast(TestRunStarting, nil)
+	// the values set by the BeforeAll hooks are passed to every test case
+	runCtx, runErr := r.executeBeforeAllHooks(ctx)
 	for _, testCase := range r.testCases {
-		err := testCase.Execute(r.bus)
-		if err != nil {
-			return err
+		if runErr != nil || ctx.Err() != nil {
+			testCase.Skip(r.bus)
+			continue
+		}
+		testCase.Execute(runCtx, r.bus)
+		if r.failFast && (testCase.Result.Status == FailedResult || testCase.Result.Status == AmbiguousResult) {
+			cancel()
+		}
+	}
+	err := r.executeAfterAllHooks(runCtx)
+	if runErr == nil {
+		runErr = err
+	}
+	if atomic.LoadInt32(&interrupted) == 1 {
+		r.summary.Interrupted = true
+		runErr = interruptedError(runErr)
+	}
+	r.summary.Duration = time.Since(start)
+	r.bus.Broadcast(TestRunFinished, r.summary)
+	return r.summary, runErr
+}
+
+// interruptedError returns the error of an interrupted run. The error of a
+// BeforeAll or AfterAll hook that failed the run is kept, with the interrupt
+// appended to it.
+func interruptedError(err error) error {
+	description := "the run was interrupted, the test cases that had not started were skipped"
+	if cucumberErr, ok := err.(*CucumberError); ok {
+		return &CucumberError{
+			Name:        cucumberErr.Name,
+			Description: cucumberErr.Description + "\n    then " + description,
+		}
+	}
+	return &CucumberError{
+		Name:        "Interrupted",
+		Description: description,
+	}
+}
+
+// executeBeforeAllHooks runs the BeforeAll hooks once before any test case and
+// returns the context for the test cases, which holds the values of the
+// contexts returned by the hooks and is cancelled with the run. The first
+// failing hook aborts the run, the hooks after it are skipped.
+func (r *Runner) executeBeforeAllHooks(ctx context.Context) (context.Context, error) {
+	var runErr error
+	values := ctx
+	for _, hook := range r.beforeAllHooks {
+		step, hookCtx := executeHook(r.bus, BeforeAllHookStepType, values, 0, r.world, hook, runErr != nil)
+		if step.Result.Status == FailedResult {
+			runErr = &CucumberError{
+				Name:        "BeforeAll Hook Failed",
+				Description: step.Result.Error.Error(),
+			}
+		}
+		values = hookCtx
+	}
+	if values == ctx {
+		return ctx, runErr
+	}
+	return valuesContext{
+		Context: ctx,
+		values:  values,
+	}, runErr
+}
+
+// executeAfterAllHooks runs every AfterAll hook once after the last test case,
+// regardless of how the run went, even when the run was cancelled.
+func (r *Runner) executeAfterAllHooks(ctx context.Context) error {
+	var runErr error
+	for _, hook := range r.afterAllHooks {
+		step, _ := executeHook(r.bus, AfterAllHookStepType, detachedContext{ctx}, 0, r.world, hook, false)
+		if step.Result.Status == FailedResult && runErr == nil {
+			runErr = &CucumberError{
+				Name:        "AfterAll Hook Failed",
+				Description: step.Result.Error.Error(),
+			}
 		}
 	}
-	r.bus.Broadcast(TestRunFinished, nil)
-	return nil
+	return runErr
 }
 
-func NewRunner(world interface{}, testCases []*TestCase, bus *EventBus) *Runner {
+func NewRunner(world interface{}, testCases []*TestCase, beforeAllHooks []*Hook, afterAllHooks []*Hook, bus *EventBus) *Runner {
 	return &Runner{
-		pendingSteps: map[string]*TestStep{},
-		world:        world,
-		testCases:    testCases,
-		bus:          bus,
+		undefinedSteps: map[string]bool{},
+		world:          world,
+		testCases:      testCases,
+		beforeAllHooks: beforeAllHooks,
+		afterAllHooks:  afterAllHooks,
+		bus:            bus,
+		summary:        newRunSummary(),
 	}
 }
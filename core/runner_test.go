@@ -0,0 +1,386 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runFeature runs a feature written to a temporary file with the given
+// cucumber
+func runFeature(t *testing.T, c *Cucumber, feature string, params *ExecuteParams) (*RunSummary, error) {
+	dir, err := ioutil.TempDir("", "cucumber")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.feature")
+	if err := ioutil.WriteFile(path, []byte(feature), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if params == nil {
+		params = &ExecuteParams{}
+	}
+	params.FeaturesPath = path
+	return c.Execute(params)
+}
+
+func TestRunSummaryFailed(t *testing.T) {
+	feature := `Feature: summary
+  Scenario: first
+    Given a step
+`
+	cases := []struct {
+		name   string
+		setup  func(c *Cucumber)
+		failed bool
+	}{
+		{"passed", func(c *Cucumber) {
+			c.Step()("a step", func(world interface{}) error { return nil })
+		}, false},
+		{"failed step", func(c *Cucumber) {
+			c.Step()("a step", func(world interface{}) error { return errors.New("failed") })
+		}, true},
+		{"undefined step", func(c *Cucumber) {}, true},
+		{"pending step", func(c *Cucumber) {
+			c.Step()("a step", func(world interface{}) error { return ErrPending })
+		}, true},
+		{"failed BeforeAll hook", func(c *Cucumber) {
+			c.Step()("a step", func(world interface{}) error { return nil })
+			c.BeforeAll(func(world interface{}) error { return errors.New("failed") })
+		}, true},
+		{"failed AfterAll hook", func(c *Cucumber) {
+			c.Step()("a step", func(world interface{}) error { return nil })
+			c.AfterAll(func(world interface{}) error { return errors.New("failed") })
+		}, true},
+	}
+	for _, item := range cases {
+		c := NewCucumber()
+		item.setup(c)
+		summary, _ := runFeature(t, c, feature, nil)
+		if summary.Failed() != item.failed {
+			t.Errorf("%s: expected Failed() to be %t", item.name, item.failed)
+		}
+	}
+}
+
+func TestBeforeAllContext(t *testing.T) {
+	type key struct{}
+	c := NewCucumber()
+	c.BeforeAllContext(func(ctx context.Context, world interface{}) (context.Context, error) {
+		return context.WithValue(ctx, key{}, "shared"), nil
+	})
+	values := []interface{}{}
+	c.Step()("a step", func(ctx context.Context, world interface{}) error {
+		values = append(values, ctx.Value(key{}))
+		return nil
+	})
+	c.AfterContext(func(ctx context.Context, world interface{}) (context.Context, error) {
+		values = append(values, ctx.Value(key{}))
+		return nil, nil
+	})
+	summary, err := runFeature(t, c, `Feature: context
+  Scenario: first
+    Given a step
+
+  Scenario: second
+    Given a step
+`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Failed() || len(values) != 4 {
+		t.Fatalf("expected the steps and After hooks of both scenarios to run but got %v", values)
+	}
+	for _, value := range values {
+		if value != "shared" {
+			t.Errorf("expected the steps and After hooks to see the BeforeAll context value but got %v", values)
+		}
+	}
+}
+
+func TestInterrupt(t *testing.T) {
+	c := NewCucumber()
+	steps := map[string]*TestStep{}
+	c.AddOuputFormatter(func(event *Event) {
+		if step, ok := event.Data.(*TestStep); ok && event.Name == TestStepFinished && step.PickleStep != nil {
+			steps[step.PickleStep.Text] = step
+		}
+	})
+	c.Step()("the run is interrupted", func(ctx context.Context, world interface{}) error {
+		process, err := os.FindProcess(os.Getpid())
+		if err != nil {
+			return err
+		}
+		if err := process.Signal(os.Interrupt); err != nil {
+			return err
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	c.Step()("a step", func(world interface{}) error {
+		return nil
+	})
+	afterHooks := 0
+	c.After(func(world interface{}) error {
+		afterHooks++
+		return nil
+	})
+	c.AfterAll(func(world interface{}) error {
+		return errors.New("cleanup failed")
+	})
+	summary, err := runFeature(t, c, `Feature: interrupt
+  Scenario: first
+    Given the run is interrupted
+
+  Scenario: second
+    Given a step
+`, &ExecuteParams{HandleSignals: true})
+	if !summary.Interrupted {
+		t.Errorf("expected the run to be interrupted")
+	}
+	if cucumberErr, ok := err.(*CucumberError); !ok || cucumberErr.Name != "AfterAll Hook Failed" || !strings.Contains(cucumberErr.Description, "interrupted") {
+		t.Errorf("expected the AfterAll error followed by the interrupt but got %v", err)
+	}
+	if afterHooks != 1 {
+		t.Errorf("expected the After hook of the interrupted test case to run once but it ran %d times", afterHooks)
+	}
+	if step := steps["the run is interrupted"]; step == nil || step.Result.Error != ErrInterrupted {
+		t.Errorf("expected the running step to be interrupted")
+	}
+	if len(summary.FailedTestCases) != 0 || summary.Scenarios[SkippedResult] != 2 {
+		t.Errorf("expected both test cases to be skipped but got %v", summary.Scenarios)
+	}
+}
+
+func TestAroundHookOrder(t *testing.T) {
+	c := NewCucumber()
+	calls := []string{}
+	around := func(name string) AroundHook {
+		return func(world interface{}, next func() error) error {
+			calls = append(calls, name+" start")
+			err := next()
+			calls = append(calls, name+" end")
+			return err
+		}
+	}
+	c.Around(around("outer"))
+	c.Around(around("inner"))
+	c.Around(around("tagged"), "@other")
+	c.Before(func(world interface{}) error {
+		calls = append(calls, "before")
+		return nil
+	})
+	c.After(func(world interface{}) error {
+		calls = append(calls, "after")
+		return nil
+	})
+	c.Step()("a step", func(world interface{}) error {
+		calls = append(calls, "step")
+		return nil
+	})
+	_, err := runFeature(t, c, `Feature: around
+  Scenario: first
+    Given a step
+`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"outer start", "inner start", "before", "step", "after", "inner end", "outer end"}
+	if strings.Join(calls, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("expected the calls %v but got %v", expected, calls)
+	}
+}
+
+func TestAroundHookResult(t *testing.T) {
+	failure := errors.New("failed")
+	cases := []struct {
+		name   string
+		setup  func(c *Cucumber)
+		check  func(err error) bool
+		status TestResult
+	}{
+		{"passed", func(c *Cucumber) {
+			c.Step()("a step", func(world interface{}) error { return nil })
+		}, func(err error) bool { return err == nil }, PassedResult},
+		{"failed", func(c *Cucumber) {
+			c.Step()("a step", func(world interface{}) error { return failure })
+		}, func(err error) bool { return err == failure }, FailedResult},
+		{"pending", func(c *Cucumber) {
+			c.Step()("a step", func(world interface{}) error { return ErrPending })
+		}, func(err error) bool { return err == ErrPending }, PendingResult},
+		{"undefined", func(c *Cucumber) {}, func(err error) bool { return err == ErrUndefined }, UndefinedResult},
+		{"ambiguous", func(c *Cucumber) {
+			c.Step()("a step", func(world interface{}) error { return nil })
+			c.Step()("a {word}", func(world interface{}, word string) error { return nil })
+		}, func(err error) bool {
+			_, ok := err.(*AmbiguousError)
+			return ok
+		}, AmbiguousResult},
+	}
+	for _, item := range cases {
+		c := NewCucumber()
+		item.setup(c)
+		var nextErr error
+		c.Around(func(world interface{}, next func() error) error {
+			nextErr = next()
+			return nextErr
+		})
+		summary, _ := runFeature(t, c, `Feature: around
+  Scenario: first
+    Given a step
+`, nil)
+		if !item.check(nextErr) {
+			t.Errorf("%s: unexpected error from next: %v", item.name, nextErr)
+		}
+		if summary.Scenarios[item.status] != 1 {
+			t.Errorf("%s: expected the test case to be %d but got %v", item.name, item.status, summary.Scenarios)
+		}
+	}
+}
+
+type testWorld struct {
+	steps    int
+	closeErr error
+}
+
+func (w *testWorld) Close() error {
+	return w.closeErr
+}
+
+func TestWorldFactory(t *testing.T) {
+	feature := `Feature: world
+  Scenario: first
+    Given a step
+
+  Scenario: second
+    Given a step
+`
+	c := NewCucumber()
+	worlds := 0
+	c.WorldFactory = func() interface{} {
+		worlds++
+		return &testWorld{
+			closeErr: errors.New("cannot close"),
+		}
+	}
+	c.Step()("a step", func(world interface{}) error {
+		world.(*testWorld).steps++
+		if world.(*testWorld).steps != 1 {
+			return errors.New("the world is shared between test cases")
+		}
+		return nil
+	})
+	var runWorld interface{} = "unset"
+	c.BeforeAll(func(world interface{}) error {
+		runWorld = world
+		return nil
+	})
+	afterHookErrors := []error{}
+	c.AddOuputFormatter(func(event *Event) {
+		if step, ok := event.Data.(*TestStep); ok && event.Name == TestStepFinished && step.Type == AfterHookStepType {
+			afterHookErrors = append(afterHookErrors, step.Result.Error)
+		}
+	})
+	summary, err := runFeature(t, c, feature, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runWorld != nil {
+		t.Errorf("expected the BeforeAll hook to get no world but got %v", runWorld)
+	}
+	if worlds != 2 || summary.Steps[PassedResult] != 2 {
+		t.Errorf("expected a world for each of the 2 test cases but got %d worlds and the steps %v", worlds, summary.Steps)
+	}
+	if len(afterHookErrors) != 2 || afterHookErrors[0] == nil || afterHookErrors[0].Error() != "cannot close" {
+		t.Errorf("expected the Close error to fail an After hook of each test case but got %v", afterHookErrors)
+	}
+	if summary.Scenarios[FailedResult] != 2 {
+		t.Errorf("expected both test cases to fail on Close but got %v", summary.Scenarios)
+	}
+
+	// a panicking WorldFactory fails the test case without stopping the run
+	c = NewCucumber()
+	worlds = 0
+	c.WorldFactory = func() interface{} {
+		worlds++
+		if worlds == 1 {
+			panic("no world")
+		}
+		return &testWorld{}
+	}
+	c.Step()("a step", func(world interface{}) error {
+		return nil
+	})
+	summary, err = runFeature(t, c, feature, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.FailedTestCases) != 1 || summary.Scenarios[PassedResult] != 1 {
+		t.Fatalf("expected the first test case only to fail but got %v", summary.Scenarios)
+	}
+	if _, ok := summary.FailedTestCases[0].Result.Error.(*PanicError); !ok || summary.Steps[SkippedResult] != 1 {
+		t.Errorf("expected the panic to fail the test case and skip its step but got %v", summary.FailedTestCases[0].Result.Error)
+	}
+}
+
+func TestAmbiguousStep(t *testing.T) {
+	c := NewCucumber()
+	c.Step()("a step", func(world interface{}) error { return nil })
+	c.Step()("a {word}", func(world interface{}, word string) error { return nil })
+	c.Step()("another step", func(world interface{}) error { return nil })
+	var ambiguous *TestStep
+	c.AddOuputFormatter(func(event *Event) {
+		if step, ok := event.Data.(*TestStep); ok && event.Name == TestStepFinished && step.PickleStep != nil {
+			ambiguous = step
+		}
+	})
+	summary, err := runFeature(t, c, `Feature: ambiguous
+  Scenario: first
+    Given a step
+`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ambiguous.Result.Status != AmbiguousResult || len(summary.FailedTestCases) != 1 || summary.Scenarios[AmbiguousResult] != 1 {
+		t.Fatalf("expected the step and its test case to be ambiguous but got %v", summary.Scenarios)
+	}
+	message := ambiguous.Result.Error.Error()
+	for _, stepDefinition := range c.stepDefinitions[:2] {
+		expected := fmt.Sprintf("%q  # %s", stepDefinition.Expression.Source, stepDefinition.Location)
+		if !strings.Contains(message, expected) || !strings.HasPrefix(stepDefinition.Location, "runner_test.go:") {
+			t.Errorf("expected the error to list %s but got\n%s", expected, message)
+		}
+	}
+	if strings.Contains(message, "another step") {
+		t.Errorf("expected the error to list the matching step definitions only but got\n%s", message)
+	}
+}
+
+func TestSnippets(t *testing.T) {
+	summary, err := runFeature(t, NewCucumber(), `Feature: snippets
+  Scenario: first
+    Given I pay 5 for "tea"
+
+  Scenario: second
+    And the bill is paid
+
+  Scenario: third
+    Given I pay 7 for "cake"
+`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"Given(\"I pay {int} for {string}\", func(world interface{}, arg0 int, arg1 string) error {\n    // Write your step definition here\n    return nil\n})",
+		"And(\"the bill is paid\", func(world interface{}) error {\n    // Write your step definition here\n    return nil\n})",
+	}
+	if strings.Join(summary.Snippets, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected the snippets\n%s\nbut got\n%s", strings.Join(expected, "\n"), strings.Join(summary.Snippets, "\n"))
+	}
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cucumber/gherkin-go"
+)
+
+// expressionEscaper escapes the characters of step text that have a meaning
+// in a cucumber expression
+var expressionEscaper = strings.NewReplacer("\\", "\\\\", "(", "\\(", "{", "\\{", "/", "\\/")
+
+// snippetMatch is a piece of step text that becomes a parameter of a snippet
+type snippetMatch struct {
+	start         int
+	end           int
+	transformName string
+	typeName      string
+	preferred     bool
+}
+
+// compileStepDefinitionText turns the text of an undefined step into the
+// expression of its snippet and the parameters of the snippet function.
+// Text matching a transform used for snippets, such as a number or a quoted
+// string, becomes a parameter. The leftmost and then longest match wins and
+// of matches of the same text the one preferred for regexp matches.
+func (c *Cucumber) compileStepDefinitionText(text string) (string, []string) {
+	matches := []*snippetMatch{}
+	names := []string{}
+	for name, transform := range c.transformLookup {
+		if transform.UseForSnippets {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		transform := c.transformLookup[name]
+		typeName := "interface{}"
+		if transform.Type != nil {
+			typeName = transform.Type.String()
+		}
+		for _, matchIndex := range regexp.MustCompile(transform.captureRegexp()).FindAllStringIndex(text, -1) {
+			if matchIndex[0] == matchIndex[1] {
+				continue
+			}
+			matches = append(matches, &snippetMatch{
+				start:         matchIndex[0],
+				end:           matchIndex[1],
+				transformName: name,
+				typeName:      typeName,
+				preferred:     transform.PreferForRegexpMatch,
+			})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].start != matches[j].start {
+			return matches[i].start < matches[j].start
+		}
+		if matches[i].end != matches[j].end {
+			return matches[i].end > matches[j].end
+		}
+		return matches[i].preferred && !matches[j].preferred
+	})
+
+	sb := ""
+	parameters := []string{}
+	lastIndex := 0
+	for _, match := range matches {
+		if match.start < lastIndex {
+			continue
+		}
+		name := fmt.Sprintf("arg%d", len(parameters))
+		sb += expressionEscaper.Replace(text[lastIndex:match.start])
+		sb += "{" + match.transformName + "}"
+		parameters = append(parameters, name+" "+match.typeName)
+		lastIndex = match.end
+	}
+	sb += expressionEscaper.Replace(text[lastIndex:])
+	return strings.TrimSpace(sb), parameters
+}
+
+// snippet returns the Go code of a step definition for an undefined step
+func (t *TestStep) snippet() string {
+	parameters := append([]string{"world interface{}"}, t.snippetParameters...)
+	body := ""
+	switch t.PickleStep.Step.Argument.(type) {
+	case *gherkin.DocString:
+		parameters = append(parameters, "text string")
+		body = "    println(text)\n"
+	case *gherkin.DataTable:
+		parameters = append(parameters, "table *core.DataTable")
+	}
+	return fmt.Sprintf("%s(%q, func(%s) error {\n    // Write your step definition here\n%s    return nil\n})", strings.TrimSpace(t.PickleStep.Step.Keyword), t.Text, strings.Join(parameters, ", "), body)
+}
@@ -0,0 +1,56 @@
+package core
+
+import "time"
+
+// RunSummary is the outcome of a run, as returned by Cucumber.Execute
+type RunSummary struct {
+	Scenarios       map[TestResult]int
+	Steps           map[TestResult]int
+	Duration        time.Duration
+	FailedTestCases []*TestCase
+	// FailedHooks are the BeforeAll and AfterAll hook steps that failed
+	FailedHooks []*TestStep
+	// Snippets are the step definitions implementing the undefined steps, in
+	// the order the steps were found
+	Snippets []string
+	// Interrupted is set when the run was cut short by an interrupt or
+	// termination signal
+	Interrupted bool
+}
+
+// Failed reports whether any test case of the run failed or was ambiguous or
+// a BeforeAll or AfterAll hook failed. Test cases with undefined or pending
+// steps fail the run as well, since the behaviour they describe is not
+// verified.
+func (s *RunSummary) Failed() bool {
+	return len(s.FailedTestCases) > 0 || len(s.FailedHooks) > 0 ||
+		s.Scenarios[UndefinedResult] > 0 || s.Scenarios[PendingResult] > 0
+}
+
+// ScenarioCount returns the number of test cases that were run
+func (s *RunSummary) ScenarioCount() int {
+	count := 0
+	for _, value := range s.Scenarios {
+		count += value
+	}
+	return count
+}
+
+// StepCount returns the number of steps that were run
+func (s *RunSummary) StepCount() int {
+	count := 0
+	for _, value := range s.Steps {
+		count += value
+	}
+	return count
+}
+
+func newRunSummary() *RunSummary {
+	return &RunSummary{
+		Scenarios:       map[TestResult]int{},
+		Steps:           map[TestResult]int{},
+		FailedTestCases: []*TestCase{},
+		FailedHooks:     []*TestStep{},
+		Snippets:        []string{},
+	}
+}
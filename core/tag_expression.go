@@ -0,0 +1,313 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/playlyfe/cucumber/utils"
+)
+
+// TagExpression is a boolean expression over the tags of a test case such as
+// "@smoke and not (@slow or @wip)"
+type TagExpression interface {
+	Evaluate(tags []string) bool
+	String() string
+}
+
+// TagExpressionError is a syntax error in a tag expression. Column is the
+// 1-based position of the offending token.
+type TagExpressionError struct {
+	Expression string
+	Column     int
+	Message    string
+}
+
+func (e *TagExpressionError) Error() string {
+	return fmt.Sprintf("Tag expression %q has a syntax error at column %d: %s", e.Expression, e.Column, e.Message)
+}
+
+type tagLiteral struct {
+	name string
+}
+
+func (e *tagLiteral) Evaluate(tags []string) bool {
+	return utils.SetExists(tags, e.name)
+}
+
+func (e *tagLiteral) String() string {
+	return strings.NewReplacer("\\", "\\\\", "(", "\\(", ")", "\\)", " ", "\\ ", ",", "\\,").Replace(e.name)
+}
+
+type tagNot struct {
+	operand TagExpression
+}
+
+func (e *tagNot) Evaluate(tags []string) bool {
+	return !e.operand.Evaluate(tags)
+}
+
+func (e *tagNot) String() string {
+	return "not " + e.operand.String()
+}
+
+type tagAnd struct {
+	left  TagExpression
+	right TagExpression
+}
+
+func (e *tagAnd) Evaluate(tags []string) bool {
+	return e.left.Evaluate(tags) && e.right.Evaluate(tags)
+}
+
+func (e *tagAnd) String() string {
+	return "(" + e.left.String() + " and " + e.right.String() + ")"
+}
+
+type tagOr struct {
+	left  TagExpression
+	right TagExpression
+}
+
+func (e *tagOr) Evaluate(tags []string) bool {
+	return e.left.Evaluate(tags) || e.right.Evaluate(tags)
+}
+
+func (e *tagOr) String() string {
+	return "(" + e.left.String() + " or " + e.right.String() + ")"
+}
+
+type tagTrue struct{}
+
+func (e *tagTrue) Evaluate(tags []string) bool {
+	return true
+}
+
+func (e *tagTrue) String() string {
+	return "true"
+}
+
+type tagToken struct {
+	text    string
+	column  int
+	literal bool
+}
+
+// ParseTagExpression parses a tag expression made of tags, "and", "or", "not"
+// and parentheses. For compatibility with the earlier tag filters, a comma
+// between tags means "or", so "@a,@b" is the same as "@a or @b". An empty
+// expression matches every test case.
+func ParseTagExpression(expression string) (TagExpression, error) {
+	tokens, err := tokenizeTagExpression(expression)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return &tagTrue{}, nil
+	}
+	parser := &tagParser{
+		expression: expression,
+		tokens:     tokens,
+	}
+	result, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if token := parser.peek(); token != nil {
+		if token.text == ")" && !token.literal {
+			return nil, parser.error(token.column, "unmatched ')'")
+		}
+		return nil, parser.error(token.column, fmt.Sprintf("expected 'and', 'or' or the end of the expression but found %q", token.text))
+	}
+	return result, nil
+}
+
+// parseTagExpressions parses a list of tag expressions that must all match
+func parseTagExpressions(expressions []string) (TagExpression, error) {
+	var result TagExpression = &tagTrue{}
+	for index, expression := range expressions {
+		parsed, err := ParseTagExpression(expression)
+		if err != nil {
+			return nil, err
+		}
+		if index == 0 {
+			result = parsed
+		} else {
+			result = &tagAnd{
+				left:  result,
+				right: parsed,
+			}
+		}
+	}
+	return result, nil
+}
+
+func tokenizeTagExpression(expression string) ([]*tagToken, error) {
+	tokens := []*tagToken{}
+	runes := []rune(expression)
+	for index := 0; index < len(runes); index++ {
+		char := runes[index]
+		switch {
+		case unicode.IsSpace(char):
+		case char == '(' || char == ')' || char == ',':
+			tokens = append(tokens, &tagToken{
+				text:   string(char),
+				column: index + 1,
+			})
+		default:
+			start := index
+			text := ""
+			escaped := false
+			for ; index < len(runes); index++ {
+				char = runes[index]
+				if escaped {
+					text += string(char)
+					escaped = false
+				} else if char == '\\' {
+					escaped = true
+				} else if unicode.IsSpace(char) || char == '(' || char == ')' || char == ',' {
+					break
+				} else {
+					text += string(char)
+				}
+			}
+			if escaped {
+				return nil, &TagExpressionError{
+					Expression: expression,
+					Column:     index,
+					Message:    "expected a character to escape after '\\'",
+				}
+			}
+			index--
+			literal := true
+			switch text {
+			case "and", "or", "not":
+				literal = runes[start] == '\\'
+			}
+			tokens = append(tokens, &tagToken{
+				text:    text,
+				column:  start + 1,
+				literal: literal,
+			})
+		}
+	}
+	return tokens, nil
+}
+
+type tagParser struct {
+	expression string
+	tokens     []*tagToken
+	position   int
+}
+
+func (p *tagParser) peek() *tagToken {
+	if p.position >= len(p.tokens) {
+		return nil
+	}
+	return p.tokens[p.position]
+}
+
+func (p *tagParser) isOperator(token *tagToken, operators ...string) bool {
+	if token == nil || token.literal {
+		return false
+	}
+	for _, operator := range operators {
+		if token.text == operator {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *tagParser) error(column int, message string) error {
+	return &TagExpressionError{
+		Expression: p.expression,
+		Column:     column,
+		Message:    message,
+	}
+}
+
+func (p *tagParser) parseOr() (TagExpression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator(p.peek(), "or", ",") {
+		p.position++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &tagOr{
+			left:  left,
+			right: right,
+		}
+	}
+	return left, nil
+}
+
+func (p *tagParser) parseAnd() (TagExpression, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator(p.peek(), "and") {
+		p.position++
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &tagAnd{
+			left:  left,
+			right: right,
+		}
+	}
+	return left, nil
+}
+
+func (p *tagParser) parseNot() (TagExpression, error) {
+	if p.isOperator(p.peek(), "not") {
+		p.position++
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &tagNot{
+			operand: operand,
+		}, nil
+	}
+	return p.parseOperand()
+}
+
+func (p *tagParser) parseOperand() (TagExpression, error) {
+	token := p.peek()
+	if token == nil {
+		return nil, p.error(len([]rune(p.expression))+1, "expected a tag, 'not' or '(' but reached the end of the expression")
+	}
+	if p.isOperator(token, "(") {
+		p.position++
+		result, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		closing := p.peek()
+		if !p.isOperator(closing, ")") {
+			if closing == nil {
+				return nil, p.error(token.column, "unmatched '('")
+			}
+			return nil, p.error(closing.column, fmt.Sprintf("expected ')' but found %q", closing.text))
+		}
+		p.position++
+		return result, nil
+	}
+	if !token.literal {
+		return nil, p.error(token.column, fmt.Sprintf("expected a tag, 'not' or '(' but found %q", token.text))
+	}
+	if !strings.HasPrefix(token.text, "@") {
+		return nil, p.error(token.column, fmt.Sprintf("expected a tag starting with '@' but found %q", token.text))
+	}
+	p.position++
+	return &tagLiteral{
+		name: token.text,
+	}, nil
+}
@@ -0,0 +1,66 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/playlyfe/cucumber/utils"
+)
+
+func TestTagExpressionEvaluate(t *testing.T) {
+	cases := []struct {
+		expression string
+		tags       []string
+		match      bool
+	}{
+		{"", []string{"@a"}, true},
+		{"@a", []string{"@a"}, true},
+		{"@a", []string{"@b"}, false},
+		{"not @a", []string{"@b"}, true},
+		{"@a and @b", []string{"@a"}, false},
+		{"@a and @b", []string{"@a", "@b"}, true},
+		{"@a or @b", []string{"@b"}, true},
+		{"@a,@b", []string{"@b"}, true},
+		{"@smoke and not (@slow or @wip)", []string{"@smoke"}, true},
+		{"@smoke and not (@slow or @wip)", []string{"@smoke", "@wip"}, false},
+		{"not not @a", []string{"@a"}, true},
+		{"@a or @b and @c", []string{"@a"}, true},
+		{"(@a or @b) and @c", []string{"@a"}, false},
+		{"@a\\ b", []string{"@a b"}, true},
+	}
+	for _, item := range cases {
+		expression, err := ParseTagExpression(item.expression)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", item.expression, err)
+			continue
+		}
+		if match := expression.Evaluate(utils.SetCreate(item.tags)); match != item.match {
+			t.Errorf("%q with %v: expected %t but got %t", item.expression, item.tags, item.match, match)
+		}
+	}
+}
+
+func TestTagExpressionSyntaxErrors(t *testing.T) {
+	cases := []struct {
+		expression string
+		column     int
+	}{
+		{"@a and", 7},
+		{"and @a", 1},
+		{"@a @b", 4},
+		{"(@a or @b", 1},
+		{"@a or @b)", 9},
+		{"not", 4},
+		{"@a and slow", 8},
+		{"@a\\", 3},
+	}
+	for _, item := range cases {
+		_, err := ParseTagExpression(item.expression)
+		if err == nil {
+			t.Errorf("%q: expected a syntax error", item.expression)
+			continue
+		}
+		if syntaxErr, ok := err.(*TagExpressionError); !ok || syntaxErr.Column != item.column {
+			t.Errorf("%q: expected a syntax error at column %d but got %s", item.expression, item.column, err)
+		}
+	}
+}
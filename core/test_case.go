@@ -1,108 +1,520 @@
 package core
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"reflect"
+	"time"
 )
 
 type TestResult int
 
 const (
-	PassedResult  TestResult = 1
-	PendingResult TestResult = 2
-	FailedResult  TestResult = 3
-	SkippedResult TestResult = 4
+	PassedResult    TestResult = 1
+	PendingResult   TestResult = 2
+	FailedResult    TestResult = 3
+	SkippedResult   TestResult = 4
+	UndefinedResult TestResult = 5
+	AmbiguousResult TestResult = 6
+)
+
+// severity orders the results from the best to the worst, the result of a
+// test case is the worst result of its steps and hooks
+var severity = map[TestResult]int{
+	PassedResult:    0,
+	SkippedResult:   1,
+	PendingResult:   2,
+	UndefinedResult: 3,
+	AmbiguousResult: 4,
+	FailedResult:    5,
+}
+
+// ErrPending can be returned by a step definition or hook that is not
+// implemented yet. The step is marked pending and the rest of the test case
+// is skipped.
+var ErrPending = errors.New("pending")
+
+// ErrSkip can be returned by a step definition or hook to skip the rest of the
+// test case without failing it.
+var ErrSkip = errors.New("skipped")
+
+// ErrUndefined is the error around hooks receive from next when a step of the
+// test case is undefined
+var ErrUndefined = errors.New("undefined")
+
+// ErrInterrupted is the error of a step or hook that was running when the run
+// was interrupted. It is skipped rather than failed, the run itself ends with
+// an Interrupted error.
+var ErrInterrupted = errors.New("interrupted")
+
+// resultStatus maps the error returned by a step definition or hook to the
+// status of its result, the sentinel errors may be wrapped
+func resultStatus(err error) TestResult {
+	switch {
+	case err == nil:
+		return PassedResult
+	case errors.Is(err, ErrPending):
+		return PendingResult
+	case errors.Is(err, ErrSkip), errors.Is(err, ErrInterrupted):
+		return SkippedResult
+	}
+	return FailedResult
+}
+
+// interruption returns ErrInterrupted in place of the error of a step or hook
+// that stopped because ctx, the context it was run with, was cancelled
+func interruption(ctx context.Context, err error) error {
+	if errors.Is(err, context.Canceled) && ctx.Err() == context.Canceled {
+		return ErrInterrupted
+	}
+	return err
+}
+
+// Result is the outcome of a test step or a test case. Error holds the
+// reason of a failure and Duration the time spent executing.
+type Result struct {
+	Status   TestResult
+	Error    error
+	Duration time.Duration
+}
+
+type TestStepType int
+
+const (
+	PickleStepType        TestStepType = 0
+	BeforeHookStepType    TestStepType = 1
+	AfterHookStepType     TestStepType = 2
+	AroundHookStepType    TestStepType = 3
+	BeforeAllHookStepType TestStepType = 4
+	AfterAllHookStepType  TestStepType = 5
 )
 
 type TestCase struct {
-	BeforeHooks []BeforeHook
-	AfterHooks  []AfterHook
-	Result      TestResult
-	Steps       []*TestStep
-	Pickle      *Pickle
+	World           interface{}
+	WorldFactory    func() interface{}
+	transformLookup map[string]*Transform
+	BeforeHooks     []*Hook
+	AfterHooks      []*Hook
+	AroundHooks     []*Hook
+	Result          Result
+	Steps           []*TestStep
+	Pickle          *Pickle
+	hookSteps       []*TestStep
+	err             error
+	// ctx is the context passed to the next step or hook
+	ctx context.Context
+	// stepTimeout limits the steps and hooks of the test case
+	stepTimeout time.Duration
 }
 
 type TestStep struct {
+	Type           TestStepType
 	Arguments      []*argument
 	StepDefinition *StepDefinition
-	Result         TestResult
-	PickleStep     *PickleStep
-	Text           string
+	// Hook is the hook run by a hook step
+	Hook *Hook
+	// AmbiguousStepDefinitions lists the step definitions matching an
+	// ambiguous step
+	AmbiguousStepDefinitions []*StepDefinition
+	Result                   Result
+	PickleStep               *PickleStep
+	// Text is the expression of the snippet for the step
+	Text string
+	// snippetParameters are the parameters of the snippet for the step, such
+	// as "arg0 int64"
+	snippetParameters []string
 }
 
-func (t *TestCase) Execute(bus *EventBus) error {
+// Execute runs the test case with a context derived from ctx, which carries
+// the Scenario of the test case. A cancelled context fails the running step
+// and skips the steps after it, the After hooks still run.
+func (t *TestCase) Execute(ctx context.Context, bus *EventBus) {
 	bus.Broadcast(TestCaseStarting, t)
+	start := time.Now()
+	t.ctx = withScenario(ctx, t.Pickle)
+	if err := t.newWorld(); err != nil {
+		// a failing WorldFactory is reported like a failed before hook, the
+		// test case cannot run without its world
+		t.failStep(bus, BeforeHookStepType, err)
+		t.skipSteps(bus)
+	} else {
+		t.executeAroundHooks(bus)
+	}
+	if closer, ok := t.World.(io.Closer); ok && t.WorldFactory != nil {
+		// the world disposal is reported like any other after hook
+		t.executeHook(bus, AfterHookStepType, &Hook{
+			Fn: AfterHook(func(world interface{}) error {
+				return closer.Close()
+			}),
+		}, false)
+	}
+	t.Result = Result{
+		Status:   t.status(),
+		Error:    t.err,
+		Duration: time.Since(start),
+	}
+	bus.Broadcast(TestCaseFinished, t)
+}
+
+// newWorld builds the world of the test case with its WorldFactory, a panic
+// of the factory is returned as a PanicError
+func (t *TestCase) newWorld() (err error) {
+	if t.WorldFactory == nil {
+		return nil
+	}
+	defer capturePanic(&err)
+	t.World = t.WorldFactory()
+	return nil
+}
+
+// executeAroundHooks runs the steps and the before and after hooks of the test
+// case wrapped in its around hooks
+func (t *TestCase) executeAroundHooks(bus *EventBus) {
+	ran := false
+	var resultErr error
+	next := func() error {
+		ran = true
+		t.executeSteps(bus)
+		resultErr = t.resultError()
+		return resultErr
+	}
+	// the first registered around hook is the outermost one
+	for index := len(t.AroundHooks) - 1; index >= 0; index-- {
+		hook := t.AroundHooks[index].Fn
+		inner := next
+		next = func() error {
+			return callAroundHook(t.ctx, hook, t.World, inner)
+		}
+	}
+	err := next()
+	if !ran {
+		t.skipSteps(bus)
+	}
+	if err != nil && err != resultErr {
+		// an around hook failed on its own account rather than passing on the
+		// error of the test case it wraps
+		t.failStep(bus, AroundHookStepType, err)
+	}
+}
+
+// failStep reports a failure of the test case that happened outside of its
+// steps and hooks as a failed hook step
+func (t *TestCase) failStep(bus *EventBus, stepType TestStepType, err error) {
+	step := &TestStep{
+		Type: stepType,
+		Result: Result{
+			Status: FailedResult,
+			Error:  err,
+		},
+	}
+	bus.Broadcast(TestStepStarting, step)
+	t.fail(err)
+	bus.Broadcast(TestStepFinished, step)
+}
+
+// skipSteps reports the steps of the test case as skipped
+func (t *TestCase) skipSteps(bus *EventBus) {
+	for _, step := range t.Steps {
+		bus.Broadcast(TestStepStarting, step)
+		step.Result = Result{Status: SkippedResult}
+		bus.Broadcast(TestStepFinished, step)
+	}
+}
+
+// Skip reports the test case and its steps as skipped without running them
+func (t *TestCase) Skip(bus *EventBus) {
+	bus.Broadcast(TestCaseStarting, t)
+	t.skipSteps(bus)
+	t.Result = Result{Status: SkippedResult}
+	bus.Broadcast(TestCaseFinished, t)
+}
+
+func (t *TestCase) executeSteps(bus *EventBus) {
 	skipSteps := false
+	for _, hook := range t.BeforeHooks {
+		if t.executeHook(bus, BeforeHookStepType, hook, skipSteps) != PassedResult {
+			skipSteps = true
+		}
+	}
 	for _, step := range t.Steps {
 		bus.Broadcast(TestStepStarting, step)
 		if skipSteps {
-			step.Result = SkippedResult
+			step.Result = Result{Status: SkippedResult}
+		} else if len(step.AmbiguousStepDefinitions) > 0 {
+			step.Result = Result{
+				Status: AmbiguousResult,
+				Error: &AmbiguousError{
+					Text:            step.PickleStep.Text,
+					StepDefinitions: step.AmbiguousStepDefinitions,
+				},
+			}
+			skipSteps = true
+		} else if step.StepDefinition == nil {
+			step.Result = Result{Status: UndefinedResult}
+			skipSteps = true
 		} else {
-			if step.StepDefinition == nil {
-				step.Result = PendingResult
+			t.executeStep(step)
+			if step.Result.Status != PassedResult {
 				skipSteps = true
-			} else {
-
-				stepDefinitionFn := reflect.ValueOf(step.StepDefinition.Fn)
-				stepDefinitionType := reflect.TypeOf(step.StepDefinition.Fn)
-				if stepDefinitionType.Kind() != reflect.Func {
-					return &CucumberError{
-						Name:        "Invalid Step Definition",
-						Description: "Step definition must be a function",
-					}
-				}
-
-				if stepDefinitionType.NumIn() != len(step.Arguments) {
-					return &CucumberError{
-						Name:        "Step Definition Parameter Count Mismatch",
-						Description: fmt.Sprintf("Step definition must contain %d arguments but found %d arguments", len(step.Arguments), stepDefinitionType.NumIn()),
-					}
-				}
-
-				arguments := []reflect.Value{}
-				argumentTypes := []reflect.Type{}
-				for index, argument := range step.Arguments {
-					argumentType := stepDefinitionType.In(index)
-					if argument.transformedValue == nil {
-						arguments = append(arguments, reflect.New(argumentType).Elem())
-						argumentTypes = append(argumentTypes, argumentType)
-					} else {
-						arguments = append(arguments, reflect.ValueOf(argument.transformedValue))
-						argumentTypes = append(argumentTypes, reflect.TypeOf(argument.transformedValue))
-					}
-				}
-
-				if !(len(arguments) == stepDefinitionType.NumIn() || (stepDefinitionType.IsVariadic() && len(arguments) >= stepDefinitionType.NumIn()-1)) {
-					typeList := ""
-					for index, argumentType := range argumentTypes {
-						if index > 0 {
-							typeList += ", "
-							typeList += argumentType.Name()
-						} else {
-							typeList += "interface{}"
-						}
-
-					}
-
-					return &CucumberError{
-						Name:        "Invalid arguments in Step Definition",
-						Description: fmt.Sprintf("Step definition for:\n\n%s\n\nmust have a function with signature: func(%s) error", step.Text, typeList),
-					}
-				}
-
-				results := stepDefinitionFn.Call(arguments)
-				if !results[0].IsNil() {
-					err := results[0].Interface().(error)
-					println(err.Error())
-					step.Result = FailedResult
-					skipSteps = true
-				} else {
-					step.Result = PassedResult
-				}
 			}
 		}
 		bus.Broadcast(TestStepFinished, step)
 	}
-	bus.Broadcast(TestCaseFinished, t)
+	for _, hook := range t.AfterHooks {
+		t.executeHook(bus, AfterHookStepType, hook, false)
+	}
+}
+
+// status rolls the results of the steps and hooks up into the status of the
+// test case, which is the worst status found. Any failure recorded outside of
+// a step fails the test case.
+func (t *TestCase) status() TestResult {
+	if t.err != nil {
+		return FailedResult
+	}
+	result := PassedResult
+	for _, step := range append(t.hookSteps, t.Steps...) {
+		if severity[step.Result.Status] > severity[result] {
+			result = step.Result.Status
+		}
+	}
+	return result
+}
+
+// resultError returns the error describing the status of the test case,
+// which around hooks receive from next. It is nil for a passed test case.
+func (t *TestCase) resultError() error {
+	switch t.status() {
+	case FailedResult:
+		return t.err
+	case PendingResult:
+		return ErrPending
+	case SkippedResult:
+		return ErrSkip
+	case UndefinedResult:
+		return ErrUndefined
+	case AmbiguousResult:
+		for _, step := range t.Steps {
+			if step.Result.Status == AmbiguousResult {
+				return step.Result.Error
+			}
+		}
+	}
 	return nil
 }
+
+// fail records the first error encountered while executing the test case.
+func (t *TestCase) fail(err error) {
+	if t.err == nil {
+		t.err = err
+	}
+}
+
+// executeHook runs a single before or after hook of the test case and returns
+// the status of its result. After hooks run even when the context of the test
+// case is cancelled.
+func (t *TestCase) executeHook(bus *EventBus, stepType TestStepType, hook *Hook, skip bool) TestResult {
+	ctx := t.ctx
+	if stepType == AfterHookStepType {
+		ctx = detachedContext{t.ctx}
+	}
+	step, ctx := executeHook(bus, stepType, ctx, t.stepTimeout, t.World, hook, skip)
+	if stepType == BeforeHookStepType {
+		t.ctx = ctx
+	}
+	t.hookSteps = append(t.hookSteps, step)
+	if step.Result.Status == FailedResult {
+		t.fail(step.Result.Error)
+	}
+	return step.Result.Status
+}
+
+// executeHook runs a hook and reports it on the bus as a hook step with its
+// own result. Skipped hooks are reported without being called. The context
+// returned by the hook is returned for the steps after it.
+func executeHook(bus *EventBus, stepType TestStepType, ctx context.Context, timeout time.Duration, world interface{}, hook *Hook, skip bool) (*TestStep, context.Context) {
+	step := &TestStep{
+		Type: stepType,
+		Hook: hook,
+	}
+	bus.Broadcast(TestStepStarting, step)
+	if skip {
+		step.Result = Result{Status: SkippedResult}
+	} else {
+		start := time.Now()
+		result, err := runWithTimeout(ctx, timeout, func(ctx context.Context) (context.Context, error) {
+			return callHook(ctx, hook.Fn, world)
+		})
+		err = interruption(ctx, err)
+		ctx = result
+		step.Result = Result{
+			Status:   resultStatus(err),
+			Duration: time.Since(start),
+		}
+		if step.Result.Status == FailedResult || errors.Is(err, ErrInterrupted) {
+			step.Result.Error = err
+		}
+	}
+	bus.Broadcast(TestStepFinished, step)
+	return step, ctx
+}
+
+// callHook calls a before or after hook and returns the context for the
+// steps after it
+func callHook(ctx context.Context, fn interface{}, world interface{}) (result context.Context, err error) {
+	result = ctx
+	defer capturePanic(&err)
+	switch hook := fn.(type) {
+	case BeforeHook:
+		return ctx, hook(world)
+	case AfterHook:
+		return ctx, hook(world)
+	case ContextHook:
+		return passContext(ctx)(hook(ctx, world))
+	}
+	return ctx, nil
+}
+
+// passContext returns a function keeping ctx when a hook or step returns a
+// nil context
+func passContext(ctx context.Context) func(context.Context, error) (context.Context, error) {
+	return func(result context.Context, err error) (context.Context, error) {
+		if result == nil {
+			return ctx, err
+		}
+		return result, err
+	}
+}
+
+func callAroundHook(ctx context.Context, fn interface{}, world interface{}, next func() error) (err error) {
+	defer capturePanic(&err)
+	switch hook := fn.(type) {
+	case AroundHook:
+		return hook(world, next)
+	case ContextAroundHook:
+		return hook(ctx, world, next)
+	}
+	return next()
+}
+
+// callStepDefinition calls a step definition returning an error or a context
+// and an error
+func callStepDefinition(ctx context.Context, fn reflect.Value, arguments []reflect.Value) (result context.Context, err error) {
+	result = ctx
+	defer capturePanic(&err)
+	results := fn.Call(arguments)
+	last := results[len(results)-1]
+	if !last.IsNil() {
+		err = last.Interface().(error)
+	}
+	if len(results) == 2 && !results[0].IsNil() {
+		result = results[0].Interface().(context.Context)
+	}
+	return result, err
+}
+
+// convertArgument converts the value of a step argument to the type of the
+// step definition parameter receiving it. A panic of a parameter type parsing
+// the text itself is returned as a PanicError.
+func (t *TestCase) convertArgument(value interface{}, target reflect.Type) (result reflect.Value, err error) {
+	defer capturePanic(&err)
+	switch argument := value.(type) {
+	case *DataTable:
+		if argument.canUnmarshal(target) {
+			result, err := argument.unmarshal(target, t.transformLookup)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("Cannot convert the table to %s: %s", target, err)
+			}
+			return result, nil
+		}
+	case *DocString:
+		if target.Kind() == reflect.String {
+			return reflect.ValueOf(argument.Content).Convert(target), nil
+		}
+		if isBytes(target) {
+			return reflect.ValueOf([]byte(argument.Content)).Convert(target), nil
+		}
+		if argument.canDecode(target) {
+			result, err := argument.decode(target)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("%s:%d: cannot decode the %s doc string into %s: %s", t.Pickle.FilePath, argument.Line, argument.MediaType, target, err)
+			}
+			return result, nil
+		}
+	}
+	return convertValue(value, target)
+}
+
+// executeStep runs a step with the context of the test case, a context
+// returned by the step definition replaces it for the steps after it
+func (t *TestCase) executeStep(step *TestStep) {
+	stepDefinitionFn := reflect.ValueOf(step.StepDefinition.Fn)
+	stepDefinitionType := reflect.TypeOf(step.StepDefinition.Fn)
+
+	// the world of the test case is always passed as the first argument
+	stepArguments := append([]*argument{
+		&argument{
+			transformedValue: t.World,
+		},
+	}, step.Arguments...)
+
+	// the signature is validated on registration, only the doc string or table
+	// argument of the step can be unexpected
+	offset := argumentIndex(stepDefinitionType) - 1
+	if stepDefinitionType.NumIn() != offset+len(stepArguments) {
+		step.Result = Result{
+			Status: FailedResult,
+			Error:  fmt.Errorf("Step definition at %s takes %d arguments but step %q has %d arguments", step.StepDefinition.Location, stepDefinitionType.NumIn()-offset, step.PickleStep.Text, len(stepArguments)),
+		}
+		t.fail(step.Result.Error)
+		return
+	}
+
+	arguments := []reflect.Value{}
+	if offset > 0 {
+		// the context is filled in once its timeout is set
+		arguments = append(arguments, reflect.Value{})
+	}
+	for index, argument := range stepArguments {
+		err := argument.err
+		var value reflect.Value
+		if err == nil {
+			value, err = t.convertArgument(argument.transformedValue, stepDefinitionType.In(offset+index))
+		}
+		if err != nil {
+			step.Result = Result{
+				Status: FailedResult,
+				Error:  err,
+			}
+			t.fail(err)
+			return
+		}
+		arguments = append(arguments, value)
+	}
+
+	start := time.Now()
+	timeout := t.stepTimeout
+	if step.StepDefinition.Timeout > 0 {
+		timeout = step.StepDefinition.Timeout
+	}
+	ctx, err := runWithTimeout(t.ctx, timeout, func(ctx context.Context) (context.Context, error) {
+		if offset > 0 {
+			arguments[0] = reflect.ValueOf(&ctx).Elem()
+		}
+		return callStepDefinition(ctx, stepDefinitionFn, arguments)
+	})
+	err = interruption(t.ctx, err)
+	t.ctx = ctx
+	step.Result = Result{
+		Status:   resultStatus(err),
+		Duration: time.Since(start),
+	}
+	if step.Result.Status == FailedResult {
+		t.fail(err)
+	}
+	if step.Result.Status == FailedResult || errors.Is(err, ErrInterrupted) {
+		step.Result.Error = err
+	}
+}
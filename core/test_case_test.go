@@ -0,0 +1,27 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestResultStatus(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected TestResult
+	}{
+		{nil, PassedResult},
+		{ErrPending, PendingResult},
+		{fmt.Errorf("waiting for the API: %w", ErrPending), PendingResult},
+		{ErrSkip, SkippedResult},
+		{fmt.Errorf("not on this platform: %w", ErrSkip), SkippedResult},
+		{ErrInterrupted, SkippedResult},
+		{errors.New("pending"), FailedResult},
+	}
+	for _, item := range cases {
+		if status := resultStatus(item.err); status != item.expected {
+			t.Errorf("%v: expected the status %d but got %d", item.err, item.expected, status)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// StepOption configures a step definition on registration
+type StepOption func(stepDefinition *StepDefinition)
+
+// WithTimeout limits the time the steps of a step definition may run, it
+// overrides the default step timeout and the @timeout tag of the scenario
+func WithTimeout(timeout time.Duration) StepOption {
+	return func(stepDefinition *StepDefinition) {
+		stepDefinition.Timeout = timeout
+	}
+}
+
+// TimeoutError is the error a step or hook fails with when it runs longer
+// than its timeout
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s", e.Timeout)
+}
+
+// timeoutTagPattern matches the tags such as @timeout(30s) that set the step
+// timeout of a scenario
+var timeoutTagPattern = regexp.MustCompile("^@timeout\\((.*)\\)$")
+
+// scenarioTimeout returns the step timeout of a scenario, set by its
+// @timeout tag or else the default step timeout
+func scenarioTimeout(pickle *Pickle, defaultTimeout time.Duration) (time.Duration, error) {
+	for _, tag := range pickle.Tags {
+		match := timeoutTagPattern.FindStringSubmatch(tag)
+		if match == nil {
+			continue
+		}
+		timeout, err := time.ParseDuration(match[1])
+		if err != nil || timeout < 0 {
+			return 0, &CucumberError{
+				Name:        "Invalid Timeout Tag",
+				Description: fmt.Sprintf("%s:%d: %s must hold a duration such as @timeout(30s)", pickle.FilePath, pickle.Line, tag),
+			}
+		}
+		return timeout, nil
+	}
+	return defaultTimeout, nil
+}
+
+// runWithTimeout runs fn like runWithContext with a context that times out
+// after timeout, no timeout is applied when it is 0. A context returned by fn
+// keeps its values but loses the timeout.
+func runWithTimeout(ctx context.Context, timeout time.Duration, fn func(ctx context.Context) (context.Context, error)) (context.Context, error) {
+	if timeout <= 0 {
+		return runWithContext(ctx, func() (context.Context, error) {
+			return fn(ctx)
+		})
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	result, err := runWithContext(timeoutCtx, func() (context.Context, error) {
+		return fn(timeoutCtx)
+	})
+	if errors.Is(err, context.DeadlineExceeded) && timeoutCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		err = &TimeoutError{
+			Timeout: timeout,
+		}
+	}
+	if result == timeoutCtx {
+		return ctx, err
+	}
+	return valuesContext{
+		Context: ctx,
+		values:  result,
+	}, err
+}
+
+// valuesContext is cancelled with its embedded context but takes its values
+// from another context
+type valuesContext struct {
+	context.Context
+	values context.Context
+}
+
+func (c valuesContext) Value(key interface{}) interface{} {
+	return c.values.Value(key)
+}
@@ -0,0 +1,95 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestScenarioTimeout(t *testing.T) {
+	cases := []struct {
+		tags     []string
+		expected time.Duration
+		err      bool
+	}{
+		{nil, time.Second, false},
+		{[]string{"@slow"}, time.Second, false},
+		{[]string{"@timeout(5s)"}, 5 * time.Second, false},
+		{[]string{"@timeout(0s)"}, 0, false},
+		{[]string{"@timeout(soon)"}, 0, true},
+		{[]string{"@timeout(-1s)"}, 0, true},
+	}
+	for _, item := range cases {
+		timeout, err := scenarioTimeout(&Pickle{Tags: item.tags}, time.Second)
+		if item.err {
+			if err == nil {
+				t.Errorf("%v: expected an error", item.tags)
+			}
+			continue
+		}
+		if err != nil || timeout != item.expected {
+			t.Errorf("%v: expected %s but got %s, %v", item.tags, item.expected, timeout, err)
+		}
+	}
+}
+
+func TestStepTimeout(t *testing.T) {
+	cases := []struct {
+		name           string
+		defaultTimeout time.Duration
+		tag            string
+		stepTimeout    time.Duration
+		timeout        time.Duration
+	}{
+		{"default timeout", 20 * time.Millisecond, "", 0, 20 * time.Millisecond},
+		{"tag over default timeout", 20 * time.Millisecond, "@timeout(1s)", 0, 0},
+		{"tag with no timeout", 20 * time.Millisecond, "@timeout(0s)", 0, 0},
+		{"step definition over tag", 0, "@timeout(1s)", 30 * time.Millisecond, 30 * time.Millisecond},
+	}
+	for _, item := range cases {
+		c := NewCucumber()
+		var stepErr error
+		c.AddOuputFormatter(func(event *Event) {
+			if step, ok := event.Data.(*TestStep); ok && event.Name == TestStepFinished && step.Type == PickleStepType {
+				stepErr = step.Result.Error
+			}
+		})
+		options := []StepOption{}
+		if item.stepTimeout > 0 {
+			options = append(options, WithTimeout(item.stepTimeout))
+		}
+		c.Step()("a slow step", func(ctx context.Context, world interface{}) error {
+			select {
+			case <-time.After(100 * time.Millisecond):
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}, options...)
+		afterHooks := 0
+		c.After(func(world interface{}) error {
+			afterHooks++
+			return nil
+		})
+		_, err := runFeature(t, c, `Feature: timeout
+  `+item.tag+`
+  Scenario: slow
+    Given a slow step
+`, &ExecuteParams{StepTimeout: item.defaultTimeout})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if afterHooks != 1 {
+			t.Errorf("%s: expected the After hook to run once but it ran %d times", item.name, afterHooks)
+		}
+		if item.timeout == 0 {
+			if stepErr != nil {
+				t.Errorf("%s: unexpected error: %s", item.name, stepErr)
+			}
+			continue
+		}
+		if timeoutErr, ok := stepErr.(*TimeoutError); !ok || timeoutErr.Timeout != item.timeout {
+			t.Errorf("%s: expected a timeout after %s but got %v", item.name, item.timeout, stepErr)
+		}
+	}
+}
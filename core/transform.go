@@ -0,0 +1,97 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// regexps returns every regexp of the transform
+func (t *Transform) regexps() []string {
+	regexps := []string{}
+	if t.CaptureRegexp != "" {
+		regexps = append(regexps, t.CaptureRegexp)
+	}
+	return append(regexps, t.CaptureRegexps...)
+}
+
+// captureRegexp returns a regexp matching any of the regexps of the transform
+func (t *Transform) captureRegexp() string {
+	regexps := t.regexps()
+	if len(regexps) == 1 {
+		return regexps[0]
+	}
+	alternatives := []string{}
+	for _, item := range regexps {
+		alternatives = append(alternatives, "(?:"+item+")")
+	}
+	return strings.Join(alternatives, "|")
+}
+
+// groupCount returns the number of capture groups of the regexps of the
+// transform
+func (t *Transform) groupCount() int {
+	return regexp.MustCompile(t.captureRegexp()).NumSubexp()
+}
+
+// groupRanges returns the start and end index of the capture groups of each
+// regexp of the transform among the capture groups of all of them
+func (t *Transform) groupRanges() [][2]int {
+	ranges := [][2]int{}
+	start := 0
+	for _, item := range t.regexps() {
+		end := start + regexp.MustCompile(item).NumSubexp()
+		ranges = append(ranges, [2]int{start, end})
+		start = end
+	}
+	return ranges
+}
+
+// transform converts the text matched by the transform, groups holds the text
+// of the capture groups of its regexps. A panic of the transformer is
+// returned as a PanicError.
+func (t *Transform) transform(value string, groups []string) (result interface{}, err error) {
+	defer capturePanic(&err)
+	if t.GroupTransformer == nil {
+		return t.Transformer(value)
+	}
+	groups = t.matchingGroups(value, groups)
+	if len(groups) == 0 {
+		groups = []string{value}
+	}
+	return t.GroupTransformer(groups)
+}
+
+// matchingGroups returns the capture groups of the regexp of the transform
+// that matched value out of the capture groups of all its regexps, the first
+// regexp matching the whole value is the one the alternation picked
+func (t *Transform) matchingGroups(value string, groups []string) []string {
+	regexps := t.regexps()
+	if len(regexps) == 1 || len(groups) != t.groupCount() {
+		return groups
+	}
+	for index, groupRange := range t.groupRanges() {
+		if regexp.MustCompile("^(?:" + regexps[index] + ")$").MatchString(value) {
+			return groups[groupRange[0]:groupRange[1]]
+		}
+	}
+	return groups
+}
+
+func (t *Transform) validate() error {
+	if t == nil {
+		return fmt.Errorf("is nil")
+	}
+	if len(t.regexps()) == 0 {
+		return fmt.Errorf("has no capture regexp")
+	}
+	for _, item := range t.regexps() {
+		if _, err := regexp.Compile(item); err != nil {
+			return fmt.Errorf("has an invalid capture regexp: %s", err)
+		}
+	}
+	if t.Transformer == nil && t.GroupTransformer == nil {
+		return fmt.Errorf("has no transformer")
+	}
+	return nil
+}
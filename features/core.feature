@@ -0,0 +1,17 @@
+Feature: Core
+
+  Scenario: A feature with a single scenario
+    Given the following feature:
+      """
+      Feature: a feature
+        Scenario: a scenario
+          Given a step
+      """
+
+  Scenario: A scenario with several steps
+    Given a scenario with:
+      """
+      Given a step
+      When a step
+      Then a step
+      """
@@ -2,7 +2,9 @@ package formatter
 
 import (
 	"fmt"
+	"io"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/cucumber/gherkin-go"
 	"github.com/fatih/color"
@@ -16,6 +18,9 @@ var colorScenario = color.New(color.FgWhite).Add(color.Bold).SprintFunc()
 var colorComment = color.New(color.FgWhite).SprintFunc()
 
 var colorUndefined = color.New(color.FgYellow).SprintFunc()
+var colorUndefinedParam = color.New(color.FgYellow).Add(color.Bold).SprintFunc()
+var colorAmbiguous = color.New(color.FgRed).SprintFunc()
+var colorAmbiguousParam = color.New(color.FgRed).Add(color.Bold).SprintFunc()
 var colorPending = color.New(color.FgYellow).SprintFunc()
 var colorPendingParam = color.New(color.FgYellow).Add(color.Bold).SprintFunc()
 var colorSkipped = color.New(color.FgCyan).SprintFunc()
@@ -27,13 +32,22 @@ var colorPassedParam = color.New(color.FgGreen).Add(color.Bold).SprintFunc()
 var colorTag = color.New(color.FgCyan).SprintFunc()
 
 type prettyFormatter struct {
+	out             io.Writer
 	filePath        string
 	lineLength      int
 	currentTestCase *core.TestCase
 }
 
+// NewPrettyFormatter returns a formatter writing to the standard output
 func NewPrettyFormatter() func(event *core.Event) {
-	formatter := &prettyFormatter{}
+	return NewPrettyFormatterWithWriter(color.Output)
+}
+
+// NewPrettyFormatterWithWriter returns a formatter writing to out
+func NewPrettyFormatterWithWriter(out io.Writer) func(event *core.Event) {
+	formatter := &prettyFormatter{
+		out: out,
+	}
 	return func(event *core.Event) {
 		formatter.handleEvent(event)
 	}
@@ -48,22 +62,103 @@ func (p *prettyFormatter) handleEvent(event *core.Event) {
 		p.feature(testCase.Pickle.Feature)
 	case core.TestStepFinished:
 		testStep := event.Data.(*core.TestStep)
-		p.step(testStep)
+		if testStep.Type == core.PickleStepType {
+			p.step(testStep)
+		} else {
+			p.hook(testStep)
+		}
 	case core.TestCaseFinished:
-		fmt.Printf("\n")
+		fmt.Fprintf(p.out, "\n")
 	case core.TestRunFinished:
+		if summary, ok := event.Data.(*core.RunSummary); ok {
+			p.summary(summary)
+		}
+	}
+}
+
+func (p *prettyFormatter) summary(summary *core.RunSummary) {
+	if summary.Interrupted {
+		fmt.Fprintf(p.out, "%s\n", colorFailed("Interrupted, the scenarios that had not started were skipped"))
+	}
+	fmt.Fprintf(p.out, "%d scenarios%s\n", summary.ScenarioCount(), p.counts(summary.Scenarios))
+	fmt.Fprintf(p.out, "%d steps%s\n", summary.StepCount(), p.counts(summary.Steps))
+	fmt.Fprintf(p.out, "%s\n\n", summary.Duration)
+	if len(summary.Snippets) > 0 {
+		fmt.Fprintf(p.out, "You can implement the missing steps with the snippets below:\n\n")
+		for _, snippet := range summary.Snippets {
+			fmt.Fprintf(p.out, "%s\n\n", colorUndefined(snippet))
+		}
 	}
 }
 
+func (p *prettyFormatter) counts(counts map[core.TestResult]int) string {
+	results := []struct {
+		result  core.TestResult
+		name    string
+		colorFn func(a ...interface{}) string
+	}{
+		{core.FailedResult, "failed", colorFailed},
+		{core.AmbiguousResult, "ambiguous", colorAmbiguous},
+		{core.UndefinedResult, "undefined", colorUndefined},
+		{core.PendingResult, "pending", colorPending},
+		{core.SkippedResult, "skipped", colorSkipped},
+		{core.PassedResult, "passed", colorPassed},
+	}
+	parts := []string{}
+	for _, item := range results {
+		if counts[item.result] > 0 {
+			parts = append(parts, item.colorFn(fmt.Sprintf("%d %s", counts[item.result], item.name)))
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(parts, ", ") + ")"
+}
+
 func (p *prettyFormatter) feature(node *gherkin.Feature) {
 	p.tags(node.Tags, "")
-	fmt.Printf("%s\n\n", colorFeature("Feature: "+node.Name))
+	fmt.Fprintf(p.out, "%s\n\n", colorFeature("Feature: "+node.Name))
+}
+
+func (p *prettyFormatter) hook(testStep *core.TestStep) {
+	if testStep.Result.Status != core.FailedResult {
+		return
+	}
+	keyword := "Before"
+	switch testStep.Type {
+	case core.AfterHookStepType:
+		keyword = "After"
+	case core.AroundHookStepType:
+		keyword = "Around"
+	case core.BeforeAllHookStepType:
+		keyword = "BeforeAll"
+	case core.AfterAllHookStepType:
+		keyword = "AfterAll"
+	}
+	if testStep.Hook != nil && testStep.Hook.Location != "" {
+		fmt.Fprintf(p.out, "    %s  %s\n", colorFailed(keyword), colorComment("# "+testStep.Hook.Location))
+	} else {
+		fmt.Fprintf(p.out, "    %s\n", colorFailed(keyword))
+	}
+	p.error(testStep.Result.Error)
+}
+
+func (p *prettyFormatter) error(err error) {
+	if err == nil {
+		return
+	}
+	lines := strings.Split(err.Error(), "\n")
+	for _, line := range lines {
+		fmt.Fprintf(p.out, "      %s\n", colorFailed(line))
+	}
 }
+
 func (p *prettyFormatter) step(testStep *core.TestStep) {
 	line := fmt.Sprintf("%d", testStep.PickleStep.Step.Location.Line)
 	colorFn := colorPending
 	colorParamFn := colorPendingParam
-	switch testStep.Result {
+	switch testStep.Result.Status {
 	case core.PassedResult:
 		colorFn = colorPassed
 		colorParamFn = colorPassedParam
@@ -73,51 +168,81 @@ func (p *prettyFormatter) step(testStep *core.TestStep) {
 	case core.SkippedResult:
 		colorFn = colorSkipped
 		colorParamFn = colorSkippedParam
+	case core.UndefinedResult:
+		colorFn = colorUndefined
+		colorParamFn = colorUndefinedParam
+	case core.AmbiguousResult:
+		colorFn = colorAmbiguous
+		colorParamFn = colorAmbiguousParam
 	}
 
 	text := colorFn(testStep.PickleStep.Step.Keyword)
-	var matchIndexes [][]int
 	if testStep.StepDefinition != nil {
-		matchIndexes = testStep.StepDefinition.Expression.Regexp.FindAllStringSubmatchIndex(testStep.PickleStep.Text, -1)
 		lastIndex := 0
-		for _, matchIndex := range matchIndexes {
-			if len(matchIndex) <= 2 {
+		for _, argumentIndex := range testStep.StepDefinition.Expression.ArgumentIndexes(testStep.PickleStep.Text) {
+			if argumentIndex == nil || argumentIndex[0] < lastIndex {
 				continue
 			}
-			text += colorFn(testStep.PickleStep.Text[lastIndex:matchIndex[2]])
-			text += colorParamFn(testStep.PickleStep.Text[matchIndex[2]:matchIndex[3]])
-			lastIndex = matchIndex[3]
+			text += colorFn(testStep.PickleStep.Text[lastIndex:argumentIndex[0]])
+			text += colorParamFn(testStep.PickleStep.Text[argumentIndex[0]:argumentIndex[1]])
+			lastIndex = argumentIndex[1]
 		}
 		text += colorFn(testStep.PickleStep.Text[lastIndex:])
 	} else {
 		text += colorFn(testStep.PickleStep.Text)
 	}
-	fmt.Printf("    ")
-	fmt.Printf(text)
+	fmt.Fprintf(p.out, "    ")
+	fmt.Fprint(p.out, text)
 	//for count := 0; count < p.lineLength-testStep.LineLength; count++ {
-	//	fmt.Printf(" ")
+	//	fmt.Fprintf(p.out, " ")
 	//}
-	fmt.Printf("  %s:%s\n", colorComment("# "+p.filePath), colorComment(line))
+	fmt.Fprintf(p.out, "  %s:%s\n", colorComment("# "+p.filePath), colorComment(line))
 	if docString, ok := testStep.PickleStep.Step.Argument.(*gherkin.DocString); ok {
-		fmt.Printf("    %s\n", colorParamFn(docString.Delimitter))
+		fmt.Fprintf(p.out, "    %s\n", colorParamFn(docString.Delimitter+docString.ContentType))
 		lines := strings.Split(docString.Content, "\n")
 		for _, line := range lines {
-			fmt.Printf("    %s\n", colorParamFn(line))
+			fmt.Fprintf(p.out, "    %s\n", colorParamFn(line))
+		}
+		fmt.Fprintf(p.out, "    %s\n", colorParamFn(docString.Delimitter))
+	}
+	if dataTable, ok := testStep.PickleStep.Step.Argument.(*gherkin.DataTable); ok {
+		p.dataTable(dataTable, colorFn)
+	}
+	p.error(testStep.Result.Error)
+}
+
+func (p *prettyFormatter) dataTable(dataTable *gherkin.DataTable, colorFn func(a ...interface{}) string) {
+	widths := []int{}
+	for _, row := range dataTable.Rows {
+		for index, cell := range row.Cells {
+			width := utf8.RuneCountInString(cell.Value)
+			if index >= len(widths) {
+				widths = append(widths, width)
+			} else if width > widths[index] {
+				widths[index] = width
+			}
+		}
+	}
+	for _, row := range dataTable.Rows {
+		line := "|"
+		for index, cell := range row.Cells {
+			padding := strings.Repeat(" ", widths[index]-utf8.RuneCountInString(cell.Value))
+			line += " " + cell.Value + padding + " |"
 		}
-		fmt.Printf("    %s\n", colorParamFn(docString.Delimitter))
+		fmt.Fprintf(p.out, "      %s\n", colorFn(line))
 	}
 }
 
 func (p *prettyFormatter) tags(tags []*gherkin.Tag, indent string) {
 	for index, tag := range tags {
 		if index > 0 {
-			fmt.Printf(" ")
+			fmt.Fprintf(p.out, " ")
 		} else {
-			fmt.Printf(indent)
+			fmt.Fprintf(p.out, indent)
 		}
-		fmt.Printf("%s", colorTag(tag.Name))
+		fmt.Fprintf(p.out, "%s", colorTag(tag.Name))
 		if index == len(tags)-1 {
-			fmt.Printf("\n")
+			fmt.Fprintf(p.out, "\n")
 		}
 	}
 }
@@ -1,8 +1,8 @@
 package main
 
 import (
+	"fmt"
 	"os"
-	"strconv"
 	"strings"
 
 	"github.com/playlyfe/cucumber/core"
@@ -14,32 +14,17 @@ func main() {
 	if len(os.Args) > 1 {
 		featureFilesPath = strings.TrimSuffix(os.Args[1], "/")
 	}
-	cucumber := NewCucumber()
+	cucumber := core.NewCucumber()
 	cucumber.AddOuputFormatter(formatter.NewPrettyFormatter())
-	cucumber.Execute(&core.ExecuteParams{
-		FeaturesPath: featureFilesPath,
+	summary, err := cucumber.Execute(&core.ExecuteParams{
+		FeaturesPath:  featureFilesPath,
+		HandleSignals: true,
 	})
-}
-
-func NewCucumber() *core.Cucumber {
-	c := core.NewCucumber()
-	c.AddTransform("int", &core.Transform{
-		CaptureRegexp: "-?\\d+",
-		Transformer: func(value string) (interface{}, error) {
-			return strconv.ParseInt(value, 10, 64)
-		},
-	})
-	c.AddTransform("float", &core.Transform{
-		CaptureRegexp: "-?\\d*\\.?\\d+",
-		Transformer: func(value string) (interface{}, error) {
-			return strconv.ParseFloat(value, 64)
-		},
-	})
-	c.AddTransform("string", &core.Transform{
-		CaptureRegexp: ".+",
-		Transformer: func(value string) (interface{}, error) {
-			return value, nil
-		},
-	})
-	return c
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if summary.Failed() {
+		os.Exit(1)
+	}
 }
@@ -9,7 +9,7 @@ import (
 var cucumber *core.Cucumber
 
 func TestMain(m *testing.M) {
-	cucumber = NewCucumber()
+	cucumber = core.NewCucumber()
 	cucumber.AddOuputFormatter(formatter.NewPrettyFormatter())
 
 	Given := cucumber.Step()
@@ -39,7 +39,13 @@ func TestMain(m *testing.M) {
 }
 
 func TestCucumberTCKFeatures(t *testing.T) {
-	cucumber.Execute(&core.ExecuteParams{
+	summary, err := cucumber.Execute(&core.ExecuteParams{
 		FeaturesPath: "features/core.feature",
 	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Failed() {
+		t.Errorf("%d of %d scenarios failed", len(summary.FailedTestCases), summary.ScenarioCount())
+	}
 }